@@ -33,13 +33,16 @@ package vmtools
 import (
 	"bufio"
 	"bytes"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"gopkg.in/yaml.v3"
 	"io"
+	"net/netip"
 	"os"
-	"regexp"
+	"slices"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -50,16 +53,53 @@ type Config struct {
 	Users      []User
 	Header     string
 	YamlString string
+	// Duplicates lists the duplicates dropped from the last input read.
+	Duplicates []Duplicate
+
+	csvUsernameColumn string
+	csvIpColumn       string
+	csvHeader         string
+	allowIPv6         bool
+	defaults          UserAttributes
+	allowedShells     []string
+	uidMin            int
+	uidMax            int
+	keyDir            string
+	keyCache          map[string][]string
+	revoke            bool
+	policy            UsernamePolicy
+	duplicates        string
+	reserved          map[string]bool
+	format            string
+	headerVars        map[string]string
+	headerLiteral     bool
+	now               func() time.Time
+	order             string
+	group             string
+	random            io.Reader
 }
 type opt func(*Config)
 
+// StateAbsent marks an entry whose account should be removed from the host.
+const StateAbsent = "absent"
+
 type User struct {
-	Username string `yaml:"username"`
-	Ip       string `yaml:"vm_ip"`
+	Username       string `yaml:"username" json:"username"`
+	Ip             string `yaml:"vm_ip" json:"vm_ip"`
+	State          string `yaml:"state,omitempty" json:"state,omitempty"`
+	UserAttributes `yaml:",inline"`
+	// Password is a crypt(3) hash, set by GeneratePasswords.
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+// equal reports whether u and o are the same entry. Passwords are not
+// compared, as a new one is generated on every run.
+func (u User) equal(o User) bool {
+	return u.Username == o.Username && u.Ip == o.Ip && u.State == o.State && u.UserAttributes.equal(o.UserAttributes)
 }
 
 type AdditionalUsers struct {
-	Users []User `yaml:"additional_users"`
+	Users []User `yaml:"additional_users" json:"additional_users"`
 }
 
 func NewConfig(opts ...opt) *Config {
@@ -67,6 +107,23 @@ func NewConfig(opts ...opt) *Config {
 		Input:  os.Stdin,
 		Output: os.Stdout,
 		indent: 2,
+
+		csvUsernameColumn: "username",
+		csvIpColumn:       "ip",
+		csvHeader:         CSVHeaderAuto,
+		allowIPv6:         true,
+		allowedShells:     getDefaultShells(),
+		uidMin:            1000,
+		uidMax:            60000,
+		keyCache:          make(map[string][]string),
+		policy:            PolicyStrict,
+		duplicates:        DuplicatesWarn,
+		reserved:          reservedSet(getReservedUsernames()),
+		format:            FormatYAML,
+		now:               time.Now,
+		order:             OrderInput,
+		group:             GroupNone,
+		random:            rand.Reader,
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -95,60 +152,238 @@ func WithHeader(header string) func(*Config) {
 		c.Header = header
 	}
 }
+
+// WithRevoke makes the created entries remove access instead of granting
+// it. They are marked with 'state: absent' and get no attributes.
+func WithRevoke(revoke bool) func(*Config) {
+	return func(c *Config) {
+		c.revoke = revoke
+	}
+}
+
+// WithIPv6 sets whether IPv6 addresses are accepted. They are by default.
+func WithIPv6(allowed bool) func(*Config) {
+	return func(c *Config) {
+		c.allowIPv6 = allowed
+	}
+}
 func (c *Config) GetIndent() int {
 	return c.indent
 }
 
+// CreateUser checks username against PolicyStrict and the built in list of
+// reserved usernames, and ip with ParseIP.
 func CreateUser(username string, ip string) (User, error) {
-	r, _ := regexp.Compile("^[a-z]+$")
-	lowerCase := strings.ToLower(username)
-	if !r.MatchString(lowerCase) {
-		e := fmt.Sprintf("Invalid character in username '%v'. Special characters and numbers are not allowed.", username)
-		return User{}, errors.New(e)
+	return createUser(username, ip, PolicyStrict, builtinReserved)
+}
+
+func createUser(username string, ip string, policy UsernamePolicy, reserved map[string]bool) (User, error) {
+	name, err := validateUsername(username, policy, reserved)
+	if err != nil {
+		return User{}, err
 	}
-	u := User{Username: lowerCase, Ip: ip}
+	addr, err := ParseIP(ip)
+	if err != nil {
+		return User{}, err
+	}
+	u := User{Username: name, Ip: addr.String()}
 	return u, nil
 }
 
+func validateUsername(username string, policy UsernamePolicy, reserved map[string]bool) (string, error) {
+	name, err := policy.Validate(username)
+	if err != nil {
+		return "", err
+	}
+	if reserved[strings.ToLower(name)] {
+		return "", &ReservedUsernameError{Username: name}
+	}
+	return name, nil
+}
+
+// ParseIP parses a single IPv4 or IPv6 address. IPv4-mapped IPv6
+// addresses are returned as plain IPv4, and zones are not allowed.
+func ParseIP(ip string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("Invalid ip address '%v'", ip)
+	}
+	if addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("Invalid ip address '%v': zones are not allowed", ip)
+	}
+	return addr.Unmap(), nil
+}
+
+// checkIP applies the ip address checks configured on c.
+func (c *Config) checkIP(ip string) error {
+	addr, err := ParseIP(ip)
+	if err != nil {
+		return err
+	}
+	if !c.allowIPv6 && addr.Is6() {
+		return fmt.Errorf("IPv6 address '%v' is not allowed", ip)
+	}
+	return nil
+}
+
+// newUser creates a user like CreateUser but with the username policy of c,
+// fills in the default attributes and then applies the other checks
+// configured on c.
+func (c *Config) newUser(username string, ip string, attrs UserAttributes) (User, error) {
+	u, err := createUser(username, ip, c.policy, c.reserved)
+	if err != nil {
+		return User{}, err
+	}
+	err = c.checkIP(u.Ip)
+	if err != nil {
+		return User{}, err
+	}
+	if c.revoke {
+		u.State = StateAbsent
+		return u, nil
+	}
+	u.UserAttributes = attrs.withDefaults(c.defaults)
+	keys, err := c.dirKeys(u.Username)
+	if err != nil {
+		return User{}, err
+	}
+	for _, key := range keys {
+		if !slices.Contains(u.SSHKeys, key) {
+			u.SSHKeys = append(u.SSHKeys, key)
+		}
+	}
+	err = c.validateAttributes(u.UserAttributes)
+	if err != nil {
+		return User{}, fmt.Errorf("User '%v': %v", u.Username, err)
+	}
+	return u, nil
+}
+
+// inputUser is a username read from the input, with where it was found
+// and any attributes the input gave it.
+type inputUser struct {
+	name string
+	inputPos
+	attrs UserAttributes
+}
+
+// readWords reads every whitespace separated word in r.
+func readWords(r io.Reader) ([]inputUser, error) {
+	var words []inputUser
+	reader := bufio.NewReader(r)
+	line := 0
+	for {
+		text, err := reader.ReadString('\n')
+		if len(text) > 0 {
+			line++
+			for i, field := range strings.Fields(text) {
+				words = append(words, inputUser{name: field, inputPos: linePos(line, i+1)})
+			}
+		}
+		if err == io.EOF {
+			return words, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// CreateUsers creates an entry for every username in c.Input on every ip
+// address. If any username or ip address is invalid, every invalid one is
+// returned in ValidationErrors. Repeated usernames and ip addresses are
+// handled as set by WithDuplicates.
 func (c *Config) CreateUsers(ips []string) error {
-	var usernames []string
-	var users []User
-	scanner := bufio.NewScanner(c.Input)
-	scanner.Split(bufio.ScanWords)
-	for scanner.Scan() {
-		text := strings.TrimSpace(scanner.Text())
-		if text != "" {
-			usernames = append(usernames, text)
+	usernames, err := readWords(c.Input)
+	if err != nil {
+		return err
+	}
+	return c.createUsers(usernames, ips)
+}
+
+// prepareUsers checks every username and ip address, returning all of the
+// invalid ones in ValidationErrors, and then handles duplicates.
+func (c *Config) prepareUsers(usernames []inputUser, ips []string) ([]inputUser, []string, error) {
+	var errs ValidationErrors
+	for _, w := range usernames {
+		_, err := validateUsername(w.name, c.policy, c.reserved)
+		if err != nil {
+			errs = append(errs, newValidationError(w.inputPos, w.name, err))
 		}
 	}
+	for i, ip := range ips {
+		err := c.checkIP(ip)
+		if err != nil {
+			errs = append(errs, newValidationError(ipPos(i+1), ip, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	c.Duplicates = nil
+	usernames = c.dedupeUsernames(usernames)
+	ips = c.dedupeIPs(ips)
+	if err := c.duplicateError(); err != nil {
+		return nil, nil, err
+	}
+	return usernames, ips, nil
+}
+
+// createUsers creates an entry for every username on every ip address,
+// grouped by ip address.
+func (c *Config) createUsers(usernames []inputUser, ips []string) error {
+	usernames, ips, err := c.prepareUsers(usernames, ips)
+	if err != nil {
+		return err
+	}
+
+	var errs ValidationErrors
 	user_length := len(usernames)
-	users = make([]User, user_length*len(ips))
-	var err error
+	users := make([]User, user_length*len(ips))
+	failed := make([]bool, user_length)
 	for i := 0; i < len(users); i++ {
-
-		username := usernames[i%user_length]
+		w := usernames[i%user_length]
 		ip := ips[i/user_length]
-		users[i], err = CreateUser(username, ip)
-		if err != nil {
-			return err
+		var err error
+		users[i], err = c.newUser(w.name, ip, w.attrs)
+		if err != nil && !failed[i%user_length] {
+			// Attribute errors depend only on the user, so report them once.
+			failed[i%user_length] = true
+			errs = append(errs, newValidationError(w.inputPos, w.name, err))
 		}
 	}
+	if len(errs) > 0 {
+		return errs
+	}
 
 	c.Users = users
 	return nil
 }
 func (c *Config) GenerateYaml() (string, error) {
 	var b bytes.Buffer
-	additionalusers := AdditionalUsers{Users: c.Users}
+	users, err := c.orderUsers(c.Users)
+	if err != nil {
+		return "", err
+	}
 
-	if len(additionalusers.Users) == 0 {
+	if len(users) == 0 {
 		return "", errors.New("No users detected, empty output")
 	}
 
 	encoder := yaml.NewEncoder(&b)
 	defer encoder.Close()
 	encoder.SetIndent(c.indent)
-	err := encoder.Encode(&additionalusers)
+	if c.group == GroupHost {
+		// Group comments can only be added to nodes.
+		var node *yaml.Node
+		node, err = c.usersNode(users)
+		if err == nil {
+			err = encoder.Encode(node)
+		}
+	} else {
+		err = encoder.Encode(&AdditionalUsers{Users: users})
+	}
 	if err != nil {
 		return "", err
 	}
@@ -161,11 +396,11 @@ func (c *Config) WriteYaml() error {
 	if len(c.YamlString) == 0 {
 		return errors.New("Uninitialized yaml string")
 	}
-	if len(c.Header) > 0 {
-		c.Output.Write([]byte(c.Header))
-		c.Output.Write([]byte{'\n'})
+	err := c.writeHeader(c.Output, c.headerContext())
+	if err != nil {
+		return err
 	}
-	_, err := c.Output.Write([]byte(c.YamlString))
+	_, err = c.Output.Write([]byte(c.YamlString))
 	if err != nil {
 		return err
 	}
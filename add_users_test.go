@@ -28,8 +28,8 @@ func TestCreateUser(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if want != got {
-		t.Errorf("Got %v, want %v", got, want)
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
 	}
 }
 
@@ -72,8 +72,8 @@ func TestCreateUserWithUpperCase(t *testing.T) {
 			if err != nil {
 				t.Errorf("Create user %v failed. Error: %v", tc.username, err)
 			}
-			if got != tc.want {
-				t.Errorf("Got %v, want %v", got, tc.want)
+			if !cmp.Equal(got, tc.want) {
+				t.Error(cmp.Diff(got, tc.want))
 			}
 		})
 	}
@@ -302,3 +302,51 @@ func TestInputBufferEmpty(t *testing.T) {
 		t.Error("Expected error, got nil")
 	}
 }
+
+func TestCreateUserRejectsInvalidIP(t *testing.T) {
+	t.Parallel()
+	tcs := []string{"10.90.9.999", "10.0.0.1,", "", "10.90.9", "fe80::1%eth0", "host.example.com"}
+	for _, ip := range tcs {
+		name := fmt.Sprintf("'%s' should return error", ip)
+		t.Run(name, func(t *testing.T) {
+			_, err := vmtools.CreateUser("bobby", ip)
+			if err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestCreateUserNormalisesIP(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		ip, want string
+	}{
+		{ip: "2001:0DB8:0000:0000:0000:0000:0000:0001", want: "2001:db8::1"},
+		{ip: "2001:db8:0:0:1:0:0:1", want: "2001:db8::1:0:0:1"},
+		{ip: "::ffff:10.90.9.9", want: "10.90.9.9"},
+		{ip: "10.90.9.9", want: "10.90.9.9"},
+	}
+	for _, tc := range tcs {
+		name := fmt.Sprintf("%s normalised to %s", tc.ip, tc.want)
+		t.Run(name, func(t *testing.T) {
+			got, err := vmtools.CreateUser("bobby", tc.ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Ip != tc.want {
+				t.Errorf("Got %v, want %v", got.Ip, tc.want)
+			}
+		})
+	}
+}
+
+func TestCreateUsersWithoutIPv6(t *testing.T) {
+	t.Parallel()
+	buf := strings.NewReader("bobby")
+	config := vmtools.NewConfig(vmtools.WithInput(buf), vmtools.WithIPv6(false))
+	err := config.CreateUsers([]string{"10.90.9.9", "2001:db8::1"})
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
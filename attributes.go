@@ -0,0 +1,231 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UserAttributes are the optional account settings that can be given for
+// each user, or for a whole document with WithDefaults.
+type UserAttributes struct {
+	Groups []string `yaml:"groups,omitempty" json:"groups,omitempty"`
+	Shell  string   `yaml:"shell,omitempty" json:"shell,omitempty"`
+	UID    int      `yaml:"uid,omitempty" json:"uid,omitempty"`
+	Home   string   `yaml:"home,omitempty" json:"home,omitempty"`
+	// Sudo is nil when unset, so that an explicit false is kept over a
+	// default of true.
+	Sudo *bool `yaml:"sudo,omitempty" json:"sudo,omitempty"`
+	// Expires is the date, as YYYY-MM-DD, the account is disabled on.
+	Expires string `yaml:"expires,omitempty" json:"expires,omitempty"`
+
+	SSHKeys []string `yaml:"ssh_authorized_keys,omitempty" json:"ssh_authorized_keys,omitempty"`
+}
+
+var groupRegex = regexp.MustCompile("^[a-z_][a-z0-9_-]*$")
+
+func getDefaultShells() []string {
+	return []string{"/bin/bash", "/bin/sh", "/bin/zsh", "/usr/bin/bash", "/usr/bin/sh", "/usr/bin/zsh", "/usr/bin/fish", "/bin/false", "/usr/sbin/nologin"}
+}
+
+func getAttributeNames() []string {
+	return []string{"groups", "shell", "uid", "home", "sudo", "expires", "ssh_authorized_keys"}
+}
+
+// WithDefaults sets attributes that every user gets unless the input sets
+// them for that user.
+func WithDefaults(attrs UserAttributes) func(*Config) {
+	return func(c *Config) {
+		c.defaults = attrs
+	}
+}
+
+// WithAllowedShells replaces the list of login shells users may be given.
+func WithAllowedShells(shells ...string) func(*Config) {
+	return func(c *Config) {
+		c.allowedShells = shells
+	}
+}
+
+// WithUIDRange sets the inclusive range that fixed UIDs must fall in.
+func WithUIDRange(min, max int) func(*Config) {
+	return func(c *Config) {
+		c.uidMin = min
+		c.uidMax = max
+	}
+}
+
+// withDefaults fills in every attribute of a that isn't set from d.
+func (a UserAttributes) withDefaults(d UserAttributes) UserAttributes {
+	if a.Groups == nil {
+		a.Groups = slices.Clone(d.Groups)
+	}
+	if a.Shell == "" {
+		a.Shell = d.Shell
+	}
+	if a.UID == 0 {
+		a.UID = d.UID
+	}
+	if a.Home == "" {
+		a.Home = d.Home
+	}
+	if a.Sudo == nil && d.Sudo != nil {
+		sudo := *d.Sudo
+		a.Sudo = &sudo
+	}
+	if a.Expires == "" {
+		a.Expires = d.Expires
+	}
+	if a.SSHKeys == nil {
+		a.SSHKeys = slices.Clone(d.SSHKeys)
+	}
+	return a
+}
+
+// HasSudo reports whether sudo is set and true.
+func (a UserAttributes) HasSudo() bool {
+	return a.Sudo != nil && *a.Sudo
+}
+
+// equal reports whether a and b set the same attributes. Unset and empty
+// lists are the same, as are unset and false sudo.
+func (a UserAttributes) equal(b UserAttributes) bool {
+	return slices.Equal(a.Groups, b.Groups) &&
+		a.Shell == b.Shell &&
+		a.UID == b.UID &&
+		a.Home == b.Home &&
+		a.HasSudo() == b.HasSudo() &&
+		a.Expires == b.Expires &&
+		slices.Equal(a.SSHKeys, b.SSHKeys)
+}
+
+func (c *Config) validateAttributes(a UserAttributes) error {
+	for _, group := range a.Groups {
+		if len(group) > 32 || !groupRegex.MatchString(group) {
+			return fmt.Errorf("Invalid group name '%v'", group)
+		}
+	}
+	if a.Shell != "" && !slices.Contains(c.allowedShells, a.Shell) {
+		return fmt.Errorf("Shell '%v' is not in the allowed list: %v", a.Shell, strings.Join(c.allowedShells, ", "))
+	}
+	if a.UID != 0 && (a.UID < c.uidMin || a.UID > c.uidMax) {
+		return fmt.Errorf("UID %d is outside the allowed range %d-%d", a.UID, c.uidMin, c.uidMax)
+	}
+	if a.Home != "" {
+		if !path.IsAbs(a.Home) || path.Clean(a.Home) != a.Home || strings.ContainsAny(a.Home, ": \t\n") {
+			return fmt.Errorf("Invalid home directory '%v', must be a clean absolute path", a.Home)
+		}
+	}
+	if a.Expires != "" {
+		if _, err := time.Parse(time.DateOnly, a.Expires); err != nil {
+			return fmt.Errorf("Invalid expiry date '%v', expected YYYY-MM-DD", a.Expires)
+		}
+	}
+	for i, key := range a.SSHKeys {
+		_, err := ParseAuthorizedKey(key)
+		if err != nil {
+			return fmt.Errorf("ssh key %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// ParseGroups splits a list of group names separated by commas,
+// semicolons or whitespace.
+func ParseGroups(s string) []string {
+	groups := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t'
+	})
+	if len(groups) == 0 {
+		return nil
+	}
+	return groups
+}
+
+// parseAttribute sets the attribute called name from its text value.
+func (a *UserAttributes) parseAttribute(name, value string) error {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(name) {
+	case "groups":
+		if value != "" {
+			a.Groups = ParseGroups(value)
+		}
+	case "shell":
+		a.Shell = value
+	case "uid":
+		if value == "" {
+			return nil
+		}
+		uid, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("Invalid uid '%v'", value)
+		}
+		a.UID = uid
+	case "home":
+		a.Home = value
+	case "sudo":
+		if value == "" {
+			return nil
+		}
+		sudo, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		a.Sudo = &sudo
+	case "expires":
+		a.Expires = value
+	case "ssh_authorized_keys":
+		for _, key := range strings.Split(value, "\n") {
+			if key = strings.TrimSpace(key); key != "" {
+				a.SSHKeys = append(a.SSHKeys, key)
+			}
+		}
+	default:
+		return fmt.Errorf("Unknown attribute '%v'", name)
+	}
+	return nil
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "y", "1":
+		return true, nil
+	case "false", "no", "n", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("Invalid boolean '%v'", s)
+}
@@ -0,0 +1,200 @@
+package vmtools_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCreateUsersWithDefaultAttributes(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("bobby")
+	defaults := vmtools.UserAttributes{Groups: []string{"docker"}, Shell: "/bin/zsh", Sudo: boolPtr(true)}
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithDefaults(defaults))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "bobby", Ip: "10.90.9.9", UserAttributes: defaults},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestAttributesInYamlOutput(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig()
+	config.Users = []vmtools.User{
+		{Username: "bobby", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{
+			Groups: []string{"docker", "wheel"},
+			Shell:  "/bin/bash",
+			UID:    1500,
+			Home:   "/srv/bobby",
+			Sudo:   boolPtr(true),
+		}},
+		{Username: "zoe", Ip: "10.90.9.9"},
+	}
+	got, err := config.GenerateYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `additional_users:
+  - username: bobby
+    vm_ip: 10.90.9.9
+    groups:
+      - docker
+      - wheel
+    shell: /bin/bash
+    uid: 1500
+    home: /srv/bobby
+    sudo: true
+  - username: zoe
+    vm_ip: 10.90.9.9
+`
+	if got != want {
+		t.Errorf("\nGot:\n%v\nWant:\n%v", got, want)
+	}
+}
+
+func TestInvalidAttributes(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name  string
+		attrs vmtools.UserAttributes
+	}{
+		{name: "shell not allowed", attrs: vmtools.UserAttributes{Shell: "/tmp/evil"}},
+		{name: "uid below range", attrs: vmtools.UserAttributes{UID: 500}},
+		{name: "uid above range", attrs: vmtools.UserAttributes{UID: 70000}},
+		{name: "relative home", attrs: vmtools.UserAttributes{Home: "home/bobby"}},
+		{name: "unclean home", attrs: vmtools.UserAttributes{Home: "/home/../root"}},
+		{name: "invalid group", attrs: vmtools.UserAttributes{Groups: []string{"Wheel!"}}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("bobby")), vmtools.WithDefaults(tc.attrs))
+			err := config.CreateUsers([]string{"10.90.9.9"})
+			if err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestCustomShellsAndUIDRange(t *testing.T) {
+	t.Parallel()
+	attrs := vmtools.UserAttributes{Shell: "/opt/bin/custom", UID: 200}
+	config := vmtools.NewConfig(
+		vmtools.WithInput(strings.NewReader("bobby")),
+		vmtools.WithDefaults(attrs),
+		vmtools.WithAllowedShells("/opt/bin/custom"),
+		vmtools.WithUIDRange(100, 999),
+	)
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCSVAttributeColumns(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("username,ip,groups,shell,uid,sudo\nbobby,10.90.9.9,docker;wheel,/bin/zsh,1500,yes\nzoe,10.90.9.9,,,,\n")
+	defaults := vmtools.UserAttributes{Shell: "/bin/bash"}
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithDefaults(defaults))
+	err := config.CreateUsersFromCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "bobby", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{
+			Groups: []string{"docker", "wheel"},
+			Shell:  "/bin/zsh",
+			UID:    1500,
+			Sudo:   boolPtr(true),
+		}},
+		{Username: "zoe", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{Shell: "/bin/bash"}},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestMappingAttributesAndDefaults(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader(`defaults:
+  shell: /bin/bash
+  groups: [users]
+hosts:
+  10.90.9.9:
+    - bobby
+    - username: zoe
+      shell: /bin/zsh
+      groups: [docker]
+      sudo: true
+`)
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsersFromMapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "bobby", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{Shell: "/bin/bash", Groups: []string{"users"}}},
+		{Username: "zoe", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{Shell: "/bin/zsh", Groups: []string{"docker"}, Sudo: boolPtr(true)}},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestExplicitNoSudoOverridesDefault(t *testing.T) {
+	t.Parallel()
+	defaults := vmtools.UserAttributes{Sudo: boolPtr(true)}
+	want := []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{Sudo: boolPtr(false)}},
+		{Username: "bobby", Ip: "10.90.9.9", UserAttributes: defaults},
+	}
+
+	csv := strings.NewReader("username,ip,sudo\nalice,10.90.9.9,no\nbobby,10.90.9.9,\n")
+	config := vmtools.NewConfig(vmtools.WithInput(csv), vmtools.WithDefaults(defaults))
+	err := config.CreateUsersFromCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(config.Users, want) {
+		t.Error(cmp.Diff(config.Users, want))
+	}
+
+	mapping := strings.NewReader(`hosts:
+  10.90.9.9:
+    - username: alice
+      sudo: no
+    - bobby
+`)
+	config = vmtools.NewConfig(vmtools.WithInput(mapping), vmtools.WithDefaults(defaults))
+	err = config.CreateUsersFromMapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(config.Users, want) {
+		t.Error(cmp.Diff(config.Users, want))
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	t.Parallel()
+	got := vmtools.ParseGroups("docker, wheel;users  adm")
+	want := []string{"docker", "wheel", "users", "adm"}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,163 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CloudInitDocument is the cloud-init user-data for one host.
+type CloudInitDocument struct {
+	Host     string
+	UserData string
+}
+
+// cloudInitConfig is the part of a #cloud-config document that is written.
+type cloudInitConfig struct {
+	Users []any `yaml:"users"`
+}
+
+type cloudInitUser struct {
+	Name              string   `yaml:"name"`
+	Groups            []string `yaml:"groups,omitempty"`
+	Shell             string   `yaml:"shell,omitempty"`
+	Sudo              string   `yaml:"sudo,omitempty"`
+	UID               int      `yaml:"uid,omitempty"`
+	Homedir           string   `yaml:"homedir,omitempty"`
+	Expiredate        string   `yaml:"expiredate,omitempty"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys,omitempty"`
+	Passwd            string   `yaml:"passwd,omitempty"`
+	LockPasswd        *bool    `yaml:"lock_passwd,omitempty"`
+}
+
+// cloudInitSudo is the sudo rule given to users with sudo set.
+const cloudInitSudo = "ALL=(ALL) NOPASSWD:ALL"
+
+// hostUsers is a host with the entries of c.Users for it.
+type hostUsers struct {
+	host  string
+	users []User
+}
+
+// usersByHost groups c.Users by ip address, in the order each address
+// first appears.
+func (c *Config) usersByHost() []hostUsers {
+	var hosts []hostUsers
+	index := make(map[string]int)
+	for _, u := range c.Users {
+		i, ok := index[u.Ip]
+		if !ok {
+			i = len(hosts)
+			index[u.Ip] = i
+			hosts = append(hosts, hostUsers{host: u.Ip})
+		}
+		hosts[i].users = append(hosts[i].users, u)
+	}
+	return hosts
+}
+
+// CloudInit renders a #cloud-config user-data document for each ip address
+// in c.Users. Each one keeps the image's default user and adds the users
+// assigned to the host with their groups, shell, sudo, uid, home, expiry
+// date, ssh keys and password hash. Entries marked absent are left out, as
+// are hosts with no other entries.
+func (c *Config) CloudInit() ([]CloudInitDocument, error) {
+	var docs []CloudInitDocument
+	for _, h := range c.usersByHost() {
+		config := cloudInitConfig{Users: []any{"default"}}
+		for _, u := range h.users {
+			if u.State == StateAbsent {
+				continue
+			}
+			config.Users = append(config.Users, newCloudInitUser(u))
+		}
+		if len(config.Users) == 1 {
+			continue
+		}
+		var b bytes.Buffer
+		b.WriteString("#cloud-config\n")
+		encoder := yaml.NewEncoder(&b)
+		encoder.SetIndent(c.indent)
+		err := encoder.Encode(config)
+		if err != nil {
+			return nil, err
+		}
+		encoder.Close()
+		docs = append(docs, CloudInitDocument{Host: h.host, UserData: b.String()})
+	}
+	return docs, nil
+}
+
+func newCloudInitUser(u User) cloudInitUser {
+	user := cloudInitUser{
+		Name:              u.Username,
+		Groups:            u.Groups,
+		Shell:             u.Shell,
+		UID:               u.UID,
+		Homedir:           u.Home,
+		Expiredate:        u.Expires,
+		SSHAuthorizedKeys: u.SSHKeys,
+	}
+	if u.HasSudo() {
+		user.Sudo = cloudInitSudo
+	}
+	if u.Password != "" {
+		// cloud-init locks the password unless told otherwise.
+		unlocked := false
+		user.Passwd = u.Password
+		user.LockPasswd = &unlocked
+	}
+	return user
+}
+
+// WriteCloudInit writes the documents from CloudInit to <dir>/<ip>/user-data.
+func (c *Config) WriteCloudInit(dir string) error {
+	docs, err := c.CloudInit()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		hostDir := filepath.Join(dir, doc.Host)
+		err = os.MkdirAll(hostDir, 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(hostDir, "user-data"), []byte(doc.UserData), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
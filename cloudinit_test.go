@@ -0,0 +1,80 @@
+package vmtools_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCloudInit(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig()
+	config.Users = []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{
+			Groups:  []string{"docker", "wheel"},
+			Shell:   "/bin/bash",
+			Sudo:    boolPtr(true),
+			SSHKeys: []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPj9ek6l6nzdLW221eRVo2dzS0bM/mMWELW9KZbT0IMA alice@laptop"},
+		}},
+		{Username: "bob", Ip: "10.90.9.9"},
+		{Username: "bob", Ip: "192.168.1.4", UserAttributes: vmtools.UserAttributes{UID: 1002, Home: "/srv/bob"}},
+		{Username: "carol", Ip: "192.168.1.5", State: vmtools.StateAbsent},
+	}
+	got, err := config.CloudInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vmtools.CloudInitDocument{
+		{Host: "10.90.9.9", UserData: `#cloud-config
+users:
+  - default
+  - name: alice
+    groups:
+      - docker
+      - wheel
+    shell: /bin/bash
+    sudo: ALL=(ALL) NOPASSWD:ALL
+    ssh_authorized_keys:
+      - ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPj9ek6l6nzdLW221eRVo2dzS0bM/mMWELW9KZbT0IMA alice@laptop
+  - name: bob
+`},
+		{Host: "192.168.1.4", UserData: `#cloud-config
+users:
+  - default
+  - name: bob
+    uid: 1002
+    homedir: /srv/bob
+`},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestWriteCloudInit(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig()
+	config.Users = []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9"},
+		{Username: "bob", Ip: "192.168.1.4"},
+		{Username: "carol", Ip: "192.168.1.5", State: vmtools.StateAbsent},
+	}
+	dir := t.TempDir()
+	err := config.WriteCloudInit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"10.90.9.9", "192.168.1.4"} {
+		_, err := os.Stat(filepath.Join(dir, host, "user-data"))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	_, err = os.Stat(filepath.Join(dir, "192.168.1.5"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected no directory for a host with only absent users, got %v", err)
+	}
+}
@@ -31,12 +31,15 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/JeffreySmith/vmtools"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
@@ -45,11 +48,43 @@ func main() {
 	var header string
 	var ips []string
 
-	ip := flag.String("ip", "", "Comma separated list of ip addresses.")
+	ip := flag.String("ip", "", "Comma separated list of ip addresses, CIDR prefixes (10.0.0.0/29) or ranges (10.0.0.5-10.0.0.20).")
 	output := flag.String("output", "", "Output file for generated yaml.")
 	input := flag.String("input", "", "Input file for user names.")
-	header_path := flag.String("header", "", "Path to a file containing your yaml file header (optional).")
+	header_path := flag.String("header", "", "Path to a file containing your output file header (optional). It is a Go text/template, and becomes comments in toml output.")
+	format := flag.String("format", vmtools.FormatYAML, "Output format: 'yaml', 'yaml-flow', 'json' or 'toml'.")
+	inventory := flag.String("inventory", "", "Also write an Ansible inventory of the hosts and their users to this file.")
+	inventory_format := flag.String("inventory-format", vmtools.InventoryINI, "Format of the -inventory file: 'ini' or 'yaml'.")
+	cloud_init := flag.String("cloud-init", "", "Also write cloud-init user-data for each host to <dir>/<ip>/user-data.")
+	stream := flag.Bool("stream", false, "Write entries as they are created instead of building the whole file in memory. Only for 'words' input and yaml output, without -update, -verbose, -inventory, -cloud-init or -passwords.")
+	order := flag.String("order", vmtools.OrderInput, "Order of the entries: 'input', 'username' or 'ip' (numeric).")
+	group := flag.String("group", vmtools.GroupNone, "Grouping of the entries: 'none', or 'host' to write each host's entries together under a comment.")
+	passwords_path := flag.String("passwords", "", "Give each user a random initial password, written as username:password lines to this file. Only the hashes go in the output.")
 	indentation_level := flag.Int("indent", 2, "Set the indentation level. Must be >= 2")
+	input_format := flag.String("input-format", "words", "Format of the input: 'words' (usernames), 'names' (one full name per line), 'csv' (username,ip rows), 'mapping' (yaml/json hosts document), 'passwd' (getent passwd output) or 'ldif' (LDAP export).")
+	skip_network_broadcast := flag.Bool("skip-network-broadcast", false, "Leave out the network and broadcast addresses when expanding IPv4 prefixes.")
+	max_ips := flag.Int("max-ips", vmtools.DefaultMaxTargets, "Maximum number of ip addresses that prefixes and ranges may expand to.")
+	no_ipv6 := flag.Bool("no-ipv6", false, "Reject IPv6 addresses.")
+	groups := flag.String("groups", "", "Comma separated supplementary groups given to every user.")
+	shell := flag.String("shell", "", "Login shell given to every user.")
+	sudo := flag.Bool("sudo", false, "Give every user sudo.")
+	expires := flag.String("expires", "", "Date every user's access expires on, as YYYY-MM-DD or from today in days (30d) or weeks (4w).")
+	update := flag.String("update", "", "Existing additional_users file to merge the new users into. It is rewritten unless -output is given.")
+	revoke := flag.Bool("revoke", false, "Revoke access instead of granting it. With -update, matching entries are removed from the file.")
+	policy_name := flag.String("policy", "strict", "Username policy: 'strict', 'posix', 'debian' or 'ad'.")
+	username_regex := flag.String("username-regex", "", "Custom regular expression usernames must match, instead of a -policy preset.")
+	name_pattern := flag.String("name-pattern", "flast", "How 'names' input becomes usernames: 'flast', 'firstl', 'first.last', 'first_last', 'lastf', 'first' or a pattern using {first}, {last}, {f} and {l}.")
+	collision := flag.String("collision", vmtools.CollisionLetters, "How clashing usernames from 'names' input are resolved: 'letters' or 'number'.")
+	duplicates := flag.String("duplicates", vmtools.DuplicatesWarn, "What to do with repeated usernames, ip addresses or entries: 'warn' drops them, 'fail' stops.")
+	denylist := flag.String("denylist", "", "File of extra reserved usernames, one per line, on top of the built in list.")
+	key_dir := flag.String("keys", "", "Directory of ssh public keys, read from <dir>/<username>.pub.")
+	verbose := flag.Bool("verbose", false, "Print a report of the ssh keys given to each user to stderr.")
+	ldap_group := flag.String("ldap-group", "", "Group whose members are read from 'ldif' input, by cn or DN. Every posixAccount is read if empty.")
+	uid_range := flag.String("uid-range", "1000-60000", "Range of UIDs allowed, and of the accounts imported from 'passwd' input.")
+	csv_columns := flag.String("csv-columns", "username,ip", "Comma separated username and ip columns for csv input, by header name or 1-based number.")
+	csv_header := flag.String("csv-header", vmtools.CSVHeaderAuto, "Whether csv input starts with a header row: 'auto' (detect it), 'on' or 'off'.")
+	vars := make(varsFlag)
+	flag.Var(vars, "var", "Variable for the header template, as key=value. Can be repeated.")
 	flag.Parse()
 
 	rest := flag.Args()
@@ -57,7 +92,58 @@ func main() {
 	if len(rest) > 0 {
 		ips = rest
 	}
-	if len(*ip) == 0 && len(rest) == 0 {
+	switch *format {
+	case vmtools.FormatYAML, vmtools.FormatYAMLFlow, vmtools.FormatJSON, vmtools.FormatTOML:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format '%v'\n", *format)
+		os.Exit(1)
+	}
+	switch *order {
+	case vmtools.OrderInput, vmtools.OrderUsername, vmtools.OrderIP:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown order '%v'\n", *order)
+		os.Exit(1)
+	}
+	switch *group {
+	case vmtools.GroupNone, vmtools.GroupHost:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown grouping '%v'\n", *group)
+		os.Exit(1)
+	}
+	switch *inventory_format {
+	case vmtools.InventoryINI, vmtools.InventoryYAML:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown inventory format '%v'\n", *inventory_format)
+		os.Exit(1)
+	}
+	switch *csv_header {
+	case vmtools.CSVHeaderAuto, vmtools.CSVHeaderOn, vmtools.CSVHeaderOff:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown csv header setting '%v'\n", *csv_header)
+		os.Exit(1)
+	}
+	switch *input_format {
+	case "words", "names", "csv", "mapping", "passwd", "ldif":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown input format '%v'\n", *input_format)
+		os.Exit(1)
+	}
+	if *stream && (*input_format != "words" || *format != vmtools.FormatYAML || len(*update) > 0 || *verbose || len(*inventory) > 0 || len(*cloud_init) > 0 || len(*passwords_path) > 0) {
+		fmt.Fprintf(os.Stderr, "-stream only works with 'words' input and yaml output, without -update, -verbose, -inventory, -cloud-init or -passwords\n")
+		os.Exit(1)
+	}
+	// Other formats would overwrite the file's comments and other keys.
+	if len(*update) > 0 && *format != vmtools.FormatYAML && (len(*output) == 0 || *output == *update) {
+		fmt.Fprintf(os.Stderr, "-update with '%v' output needs an -output file other than %v\n", *format, *update)
+		os.Exit(1)
+	}
+	var target_errors vmtools.ValidationErrors
+	if *input_format == "csv" || *input_format == "mapping" {
+		if len(*ip) > 0 || len(rest) > 0 {
+			fmt.Fprintf(os.Stderr, "IP addresses are read from the %v input, '-ip' cannot be used with it\n", *input_format)
+			os.Exit(1)
+		}
+	} else if len(*ip) == 0 && len(rest) == 0 {
 		fmt.Fprintf(os.Stderr, "You must supply at least 1 ip address\n\n")
 		fmt.Fprintf(os.Stderr, "Pass them either as a comma separated list after '-ip'\n")
 		fmt.Fprintf(os.Stderr, "or as a space separated list at the end of your arguments.\n\n")
@@ -71,6 +157,19 @@ func main() {
 		} else if len(rest) == 0 && len(*ip) > 0 {
 			ips = strings.Split(*ip, ",")
 		}
+		var err error
+		ips, err = vmtools.ExpandTargets(ips, vmtools.TargetOptions{
+			SkipNetworkBroadcast: *skip_network_broadcast,
+			MaxTargets:           *max_ips,
+		})
+		// Invalid targets are reported with the invalid usernames.
+		if errors.As(err, &target_errors) {
+			err = nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading ip addresses: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	if len(*input) > 0 {
@@ -85,14 +184,6 @@ func main() {
 		InputBuffer = os.Stdin
 	}
 
-	if len(*output) > 0 {
-		var err error
-		OutputBuffer, err = os.Create(*output)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
-	}
 	if len(*header_path) > 0 {
 		_, err := os.Stat(*header_path)
 		if err != nil {
@@ -109,25 +200,350 @@ func main() {
 	} else {
 		header = "---"
 	}
+	header_option := vmtools.WithHeader(header)
+
+	var doc *vmtools.UsersDocument
+	if len(*update) > 0 {
+		f, err := os.Open(*update)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		doc = vmtools.NewUsersDocument()
+		if err == nil {
+			doc, err = vmtools.LoadUsersDocument(f)
+			f.Close()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %v: %v\n", *update, err)
+				os.Exit(1)
+			}
+			// Keep the file's own header, as it is, unless -header
+			// replaces it.
+			if len(*header_path) == 0 && len(doc.Header()) > 0 && *format == vmtools.FormatYAML {
+				header_option = vmtools.WithLiteralHeader(doc.Header())
+			}
+		}
+	}
+	columns := strings.Split(*csv_columns, ",")
+	if len(columns) != 2 {
+		fmt.Fprintf(os.Stderr, "'-csv-columns' needs exactly 2 columns, got '%v'\n", *csv_columns)
+		os.Exit(1)
+	}
+	if *duplicates != vmtools.DuplicatesWarn && *duplicates != vmtools.DuplicatesFail {
+		fmt.Fprintf(os.Stderr, "Unknown duplicates setting '%v'\n", *duplicates)
+		os.Exit(1)
+	}
+	policy, err := vmtools.UsernamePolicyByName(*policy_name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(*username_regex) > 0 {
+		policy, err = vmtools.NewUsernamePolicy(*username_regex, 1, 32, true)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	var reserved []string
+	if len(*denylist) > 0 {
+		f, err := os.Open(*denylist)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		reserved, err = vmtools.ReadReservedUsernames(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %v: %v\n", *denylist, err)
+			os.Exit(1)
+		}
+	}
+	// An unset -sudo leaves sudo unset, so the input decides.
+	var sudo_default *bool
+	if *sudo {
+		sudo_default = sudo
+	}
+	var expiry string
+	if len(*expires) > 0 {
+		expiry, err = vmtools.ParseExpiry(*expires, time.Now())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	uid_min, uid_max, err := parseUIDRange(*uid_range)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -uid-range: %v\n", err)
+		os.Exit(1)
+	}
 	config := vmtools.NewConfig(vmtools.WithOutput(OutputBuffer),
 		vmtools.WithInput(InputBuffer),
-		vmtools.WithHeader(header),
+		header_option,
 		vmtools.SetIndent(*indentation_level),
+		vmtools.WithCSVColumns(columns[0], columns[1]),
+		vmtools.WithCSVHeader(*csv_header),
+		vmtools.WithIPv6(!*no_ipv6),
+		vmtools.WithDefaults(vmtools.UserAttributes{
+			Groups:  vmtools.ParseGroups(*groups),
+			Shell:   *shell,
+			Sudo:    sudo_default,
+			Expires: expiry,
+		}),
+		vmtools.WithKeyDir(*key_dir),
+		vmtools.WithRevoke(*revoke),
+		vmtools.WithUsernamePolicy(policy),
+		vmtools.WithDuplicates(*duplicates),
+		vmtools.WithReservedUsernames(reserved...),
+		vmtools.WithUIDRange(uid_min, uid_max),
+		vmtools.WithFormat(*format),
+		vmtools.WithHeaderVars(vars),
+		vmtools.WithOrder(*order),
+		vmtools.WithGrouping(*group),
 	)
 
-	err := config.CreateUsers(ips)
+	if *stream {
+		// The input is still read to report every invalid username, but
+		// nothing is written if there are invalid targets.
+		if len(target_errors) > 0 {
+			config.Output = io.Discard
+		} else if len(*output) > 0 {
+			f, err := os.Create(*output)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			config.Output = f
+		}
+		err = config.StreamUsers(ips)
+		if err != nil && len(*output) > 0 {
+			os.Remove(*output)
+		}
+		exitOnCreateError(withTargetErrors(err, target_errors))
+		for _, d := range config.Duplicates {
+			fmt.Fprintf(os.Stderr, "Warning: %v, dropped\n", d)
+		}
+		return
+	}
+
+	switch *input_format {
+	case "names":
+		var generator *vmtools.NameGenerator
+		generator, err = vmtools.NewNameGenerator(*name_pattern, *collision)
+		if err != nil {
+			break
+		}
+		var mappings []vmtools.NameMapping
+		mappings, err = config.CreateUsersFromNames(ips, generator)
+		if mappings != nil {
+			vmtools.WriteNameMappings(os.Stderr, mappings)
+		}
+	case "csv":
+		err = config.CreateUsersFromCSV()
+		var invalid vmtools.ValidationErrors
+		if errors.As(err, &invalid) && invalid[0].Line == 1 && *csv_header == vmtools.CSVHeaderAuto {
+			fmt.Fprintf(os.Stderr, "Row 1 was read as data. If it is a header, pass '-csv-header on'.\n")
+		}
+	case "mapping":
+		err = config.CreateUsersFromMapping()
+	case "passwd":
+		err = config.CreateUsersFromPasswd(ips)
+	case "ldif":
+		err = config.CreateUsersFromLDIF(ips, *ldap_group)
+	default:
+		err = config.CreateUsers(ips)
+	}
+	exitOnCreateError(withTargetErrors(err, target_errors))
+	for _, d := range config.Duplicates {
+		fmt.Fprintf(os.Stderr, "Warning: %v, dropped\n", d)
+	}
+
+	if *verbose {
+		err = config.KeyReport(os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing key report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Passwords are generated before merging, so existing entries keep
+	// theirs.
+	var passwords []vmtools.InitialPassword
+	if len(*passwords_path) > 0 {
+		passwords, err = config.GeneratePasswords()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if doc != nil {
+		if *revoke {
+			result, err := config.RemoveFromDocument(doc)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %v: %v\n", *update, err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "%d entries removed, %d not found\n", result.Removed, result.NotFound)
+		} else {
+			result, err := config.MergeDocument(doc)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %v: %v\n", *update, err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "%d entries added, %d replaced, %d already present\n", result.Added, result.Replaced, result.Present)
+		}
+		if len(*output) == 0 {
+			*output = *update
+		}
+	}
+
+	// Updated yaml files are written from the document to keep their
+	// comments, other formats are generated from the users.
+	if doc != nil && *format == vmtools.FormatYAML {
+		_, err = config.GenerateDocument(doc)
+	} else {
+		_, err = config.Generate()
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error while creating user: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error generating %v: %v\n", *format, err)
 		os.Exit(1)
 	}
 
-	_, err = config.GenerateYaml()
+	// Check the header before the output file is created.
+	_, err = config.RenderHeader()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating yaml: %v\n", err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+
+	if len(*output) > 0 {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		OutputBuffer = f
+	}
+	config.Output = OutputBuffer
 	err = config.WriteYaml()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The passwords are only written once their hashes have been.
+	if len(*passwords_path) > 0 {
+		// Leave out the passwords of users that were already in the file.
+		var used []vmtools.InitialPassword
+		for _, p := range passwords {
+			for _, u := range config.Users {
+				if u.Password == p.Hash {
+					used = append(used, p)
+					break
+				}
+			}
+		}
+		err = vmtools.WritePasswordFile(*passwords_path, used)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing passwords: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(*inventory) > 0 {
+		f, err := os.Create(*inventory)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		err = config.WriteInventory(f, *inventory_format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing inventory: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(*cloud_init) > 0 {
+		err = config.WriteCloudInit(*cloud_init)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing cloud-init user-data: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// exitOnCreateError prints err, listing every invalid entry if there are
+// several, and exits.
+func exitOnCreateError(err error) {
+	var invalid vmtools.ValidationErrors
+	if errors.As(err, &invalid) {
+		fmt.Fprintf(os.Stderr, "Found %d invalid entries:\n", len(invalid))
+		for _, e := range invalid {
+			fmt.Fprintf(os.Stderr, "  %v\n", e)
+		}
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error while creating user: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// withTargetErrors adds the invalid ip targets to the errors from reading
+// the users, so that they are all reported at once.
+func withTargetErrors(err error, targets vmtools.ValidationErrors) error {
+	if len(targets) == 0 {
+		return err
+	}
+	var invalid vmtools.ValidationErrors
+	if errors.As(err, &invalid) {
+		return append(invalid, targets...)
+	}
+	if err != nil {
+		return err
+	}
+	return targets
+}
+
+// varsFlag collects repeated -var key=value flags.
+type varsFlag map[string]string
+
+func (v varsFlag) String() string {
+	var pairs []string
+	for key, value := range v {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v varsFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("'%v' is not of the form key=value", s)
+	}
+	v[key] = value
+	return nil
+}
+
+// parseUIDRange parses a range such as 1000-60000.
+func parseUIDRange(s string) (int, int, error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("'%v' is not of the form min-max", s)
+	}
+	low, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid minimum '%v'", lo)
+	}
+	high, err := strconv.Atoi(strings.TrimSpace(hi))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid maximum '%v'", hi)
+	}
+	if low > high {
+		return 0, 0, fmt.Errorf("minimum %d is greater than maximum %d", low, high)
 	}
+	return low, high, nil
 }
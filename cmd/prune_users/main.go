@@ -0,0 +1,157 @@
+/*
+BSD 3-Clause License
+
+# Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+ 1. Redistributions of source code must retain the above copyright notice, this
+    list of conditions and the following disclaimer.
+
+ 2. Redistributions in binary form must reproduce the above copyright notice,
+    this list of conditions and the following disclaimer in the documentation
+    and/or other materials provided with the distribution.
+
+ 3. Neither the name of the copyright holder nor the names of its
+    contributors may be used to endorse or promote products derived from
+    this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/JeffreySmith/vmtools"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func main() {
+	output := flag.String("output", "", "Write the pruned file here instead of rewriting the input file.")
+	report := flag.Bool("report", false, "Only list the expired entries, without changing any file.")
+	now_date := flag.String("now", "", "Date to compare expiry dates with, as YYYY-MM-DD. Defaults to today.")
+	indentation_level := flag.Int("indent", 2, "Set the indentation level. Must be >= 2")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s: [-report] [-now YYYY-MM-DD] [-output file] users.yaml\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	path := flag.Arg(0)
+
+	now := time.Now()
+	if len(*now_date) > 0 {
+		var err error
+		now, err = time.ParseInLocation(time.DateOnly, *now_date, time.Local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -now date '%v', expected YYYY-MM-DD\n", *now_date)
+			os.Exit(1)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	doc, err := vmtools.LoadUsersDocument(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %v: %v\n", path, err)
+		os.Exit(1)
+	}
+
+	config := vmtools.NewConfig(
+		vmtools.SetIndent(*indentation_level),
+		vmtools.WithLiteralHeader(doc.Header()),
+		vmtools.WithClock(func() time.Time { return now }),
+	)
+	expired, err := config.PruneDocument(doc)
+	var invalid vmtools.ValidationErrors
+	if errors.As(err, &invalid) {
+		fmt.Fprintf(os.Stderr, "Found %d invalid expiry dates in %v:\n", len(invalid), path)
+		for _, e := range invalid {
+			fmt.Fprintf(os.Stderr, "  %v\n", e)
+		}
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %v: %v\n", path, err)
+		os.Exit(1)
+	}
+	for _, u := range expired {
+		fmt.Printf("%v on %v expired %v\n", u.Username, u.Ip, u.Expires)
+	}
+	fmt.Printf("%d entries expired\n", len(expired))
+	if *report || len(expired) == 0 {
+		return
+	}
+
+	_, err = config.GenerateDocument(doc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating yaml: %v\n", err)
+		os.Exit(1)
+	}
+	// Check the header before anything is written.
+	_, err = config.RenderHeader()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(*output) == 0 {
+		*output = path
+	}
+	err = writeFile(*output, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the file to a temporary file next to path and renames
+// it over path, so that a failed write never leaves a partial file. The
+// file keeps the mode of the file it replaces.
+func writeFile(path string, config *vmtools.Config) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	config.Output = f
+	err = config.WriteYaml()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Chmod(mode)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
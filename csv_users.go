@@ -0,0 +1,286 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// WithCSVColumns sets which columns CreateUsersFromCSV reads usernames and
+// ip addresses from. A column is either a header name (matched case
+// insensitively) or a 1-based column number.
+func WithCSVColumns(username, ip string) func(*Config) {
+	return func(c *Config) {
+		c.csvUsernameColumn = username
+		c.csvIpColumn = ip
+	}
+}
+
+// Settings for whether csv input starts with a header row.
+const (
+	// CSVHeaderAuto detects a header row. It is the default.
+	CSVHeaderAuto = "auto"
+	// CSVHeaderOn always reads the first row as a header.
+	CSVHeaderOn = "on"
+	// CSVHeaderOff reads every row as a user.
+	CSVHeaderOff = "off"
+)
+
+// WithCSVHeader sets whether CreateUsersFromCSV reads the first row as a
+// header: CSVHeaderAuto, CSVHeaderOn or CSVHeaderOff.
+func WithCSVHeader(header string) func(*Config) {
+	return func(c *Config) {
+		c.csvHeader = header
+	}
+}
+
+// csvLayout records which column holds each field of a csv input.
+type csvLayout struct {
+	username   int
+	ip         int
+	attributes map[int]string
+}
+
+// CreateUsersFromCSV reads explicit username,ip rows from c.Input instead of
+// taking the product of every username with every ip address. Unless set
+// with WithCSVHeader, the first row is treated as a header if it contains
+// the configured column names, or, with numbered columns, if it holds
+// neither an ip address nor a valid username in them. Without a header, the default columns
+// are the first and second ones.
+// A header may also name the columns groups, shell, uid, home, sudo and
+// expires to set those attributes for each user. Every invalid row is
+// returned in ValidationErrors.
+func (c *Config) CreateUsersFromCSV() error {
+	r := csv.NewReader(c.Input)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+
+	first, err := r.Read()
+	if err == io.EOF {
+		c.Users = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var users []User
+	var positions []inputPos
+	var errs ValidationErrors
+	var layout csvLayout
+	if c.isCSVHeader(first) {
+		line, _ := r.FieldPos(0)
+		layout, err = c.csvHeaderLayout(first)
+		if err != nil {
+			return fmt.Errorf("row %d: %v", line, err)
+		}
+	} else {
+		layout.username, err = csvColumnIndex(nil, c.csvUsernameColumn)
+		if err != nil {
+			return err
+		}
+		layout.ip, err = csvColumnIndex(nil, c.csvIpColumn)
+		if err != nil {
+			return err
+		}
+		line, _ := r.FieldPos(0)
+		u, err := c.csvUser(first, line, layout)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			users = append(users, u)
+			positions = append(positions, rowPos(line))
+		}
+	}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := r.FieldPos(0)
+		u, verr := c.csvUser(record, line, layout)
+		if verr != nil {
+			errs = append(errs, verr)
+			continue
+		}
+		users = append(users, u)
+		positions = append(positions, rowPos(line))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	c.Duplicates = nil
+	users = c.dedupeEntries(users, positions)
+	if err := c.duplicateError(); err != nil {
+		return err
+	}
+	c.Users = users
+	return nil
+}
+
+func (c *Config) csvHeaderLayout(header []string) (csvLayout, error) {
+	var layout csvLayout
+	var err error
+	layout.username, err = csvColumnIndex(header, c.csvUsernameColumn)
+	if err != nil {
+		return layout, err
+	}
+	layout.ip, err = csvColumnIndex(header, c.csvIpColumn)
+	if err != nil {
+		return layout, err
+	}
+	layout.attributes = make(map[int]string)
+	for i, field := range header {
+		if i == layout.username || i == layout.ip {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(field))
+		if slices.Contains(getAttributeNames(), name) {
+			layout.attributes[i] = name
+		}
+	}
+	return layout, nil
+}
+
+func (c *Config) csvUser(record []string, line int, layout csvLayout) (User, *ValidationError) {
+	pos := rowPos(line)
+	if layout.username >= len(record) || layout.ip >= len(record) {
+		err := fmt.Errorf("expected at least %d columns, got %d", max(layout.username, layout.ip)+1, len(record))
+		return User{}, newValidationError(pos, strings.Join(record, ","), err)
+	}
+	username := strings.TrimSpace(record[layout.username])
+	ip := strings.TrimSpace(record[layout.ip])
+	if username == "" {
+		return User{}, newValidationError(pos, username, errors.New("empty username"))
+	}
+	if ip == "" {
+		return User{}, newValidationError(pos, ip, errors.New("empty ip address"))
+	}
+	var attrs UserAttributes
+	for i, name := range layout.attributes {
+		if i >= len(record) {
+			continue
+		}
+		err := attrs.parseAttribute(name, record[i])
+		if err != nil {
+			return User{}, newValidationError(pos, record[i], err)
+		}
+	}
+	u, err := c.newUser(username, ip, attrs)
+	if err != nil {
+		return User{}, newValidationError(pos, username, err)
+	}
+	return u, nil
+}
+
+// isCSVHeader reports whether the first row is a header.
+func (c *Config) isCSVHeader(record []string) bool {
+	switch c.csvHeader {
+	case CSVHeaderOn:
+		return true
+	case CSVHeaderOff:
+		return false
+	}
+	if namesCSVColumn(record, c.csvUsernameColumn, c.csvIpColumn) {
+		return true
+	}
+	// Numbered columns are used for headers with any names, so a row
+	// that has neither an ip address nor a valid username in those columns
+	// is taken to be one. A row with only one of them wrong is a mistake
+	// in the data and is reported.
+	ip, err := strconv.Atoi(c.csvIpColumn)
+	if err != nil || ip < 1 || ip > len(record) {
+		return false
+	}
+	username, err := strconv.Atoi(c.csvUsernameColumn)
+	if err != nil || username < 1 || username > len(record) {
+		return false
+	}
+	if _, err := ParseIP(strings.TrimSpace(record[ip-1])); err == nil {
+		return false
+	}
+	_, err = validateUsername(strings.TrimSpace(record[username-1]), c.policy, c.reserved)
+	return err != nil
+}
+
+// namesCSVColumn reports whether a row names either of the configured
+// columns, or one of the usual column names when the columns are given as
+// numbers.
+func namesCSVColumn(record []string, columns ...string) bool {
+	columns = append(columns, "username", "ip", "vm_ip")
+	for _, field := range record {
+		for _, col := range columns {
+			if strings.EqualFold(strings.TrimSpace(field), col) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// csvColumnIndex resolves a column name or 1-based column number to a
+// 0-based index. Names can only be resolved against a header row. Without
+// a header, the default names fall back to the first two columns.
+func csvColumnIndex(header []string, column string) (int, error) {
+	if n, err := strconv.Atoi(column); err == nil {
+		if n < 1 {
+			return 0, fmt.Errorf("invalid column number %d, columns start at 1", n)
+		}
+		return n - 1, nil
+	}
+	if header == nil {
+		switch column {
+		case "username":
+			return 0, nil
+		case "ip":
+			return 1, nil
+		}
+		return 0, errors.New(fmt.Sprintf("column '%v' requires a header row", column))
+	}
+	for i, field := range header {
+		if strings.EqualFold(strings.TrimSpace(field), column) {
+			return i, nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("header has no column '%v'", column))
+}
@@ -0,0 +1,182 @@
+package vmtools_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCreateUsersFromCSVWithoutHeader(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("bobby,10.90.9.9\nzoe,192.168.1.4\n")
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsersFromCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "bobby", Ip: "10.90.9.9"},
+		{Username: "zoe", Ip: "192.168.1.4"},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestCreateUsersFromCSVWithHeader(t *testing.T) {
+	t.Parallel()
+	input, err := os.Open("testdata/users.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithCSVColumns("username", "ip"))
+	err = config.CreateUsersFromCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "bobby", Ip: "10.90.9.9"},
+		{Username: "zoe", Ip: "10.90.9.10"},
+		{Username: "alice", Ip: "192.168.1.4"},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestCreateUsersFromCSVColumnNumbers(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("10.90.9.9,infra,bobby\n")
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithCSVColumns("3", "1"))
+	err := config.CreateUsersFromCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{{Username: "bobby", Ip: "10.90.9.9"}}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestCreateUsersFromCSVHeaderSetting(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name, input, header string
+		want                []vmtools.User
+		wantErr             bool
+	}{
+		{
+			name:   "detected with other names",
+			input:  "Host,Team,Login Name\n10.90.9.9,infra,bobby\n",
+			header: vmtools.CSVHeaderAuto,
+			want:   []vmtools.User{{Username: "bobby", Ip: "10.90.9.9"}},
+		},
+		{
+			name:    "not detected with a valid username",
+			input:   "Host,Team,Login\n10.90.9.9,infra,bobby\n",
+			header:  vmtools.CSVHeaderAuto,
+			wantErr: true,
+		},
+		{
+			name:   "on",
+			input:  "Server,Team,Name\n10.90.9.9,infra,bobby\n",
+			header: vmtools.CSVHeaderOn,
+			want:   []vmtools.User{{Username: "bobby", Ip: "10.90.9.9"}},
+		},
+		{
+			name:    "off",
+			input:   "Host,Team,Login\n10.90.9.9,infra,bobby\n",
+			header:  vmtools.CSVHeaderOff,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			config := vmtools.NewConfig(
+				vmtools.WithInput(strings.NewReader(tc.input)),
+				vmtools.WithCSVColumns("3", "1"),
+				vmtools.WithCSVHeader(tc.header),
+			)
+			err := config.CreateUsersFromCSV()
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(config.Users, tc.want) {
+				t.Error(cmp.Diff(config.Users, tc.want))
+			}
+		})
+	}
+}
+
+func TestCreateUsersFromCSVReportsTypoInFirstRow(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("alice,10.0.0.999\nbob,10.0.0.2\n")
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithCSVColumns("1", "2"))
+	err := config.CreateUsersFromCSV()
+	var invalid vmtools.ValidationErrors
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	if len(invalid) != 1 || invalid[0].Line != 1 || !strings.Contains(invalid[0].Error(), "10.0.0.999") {
+		t.Errorf("Expected row 1 to be reported, got %v", err)
+	}
+}
+
+func TestCreateUsersFromCSVErrorsIncludeRow(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name, input, want string
+	}{
+		{
+			name:  "invalid username",
+			input: "username,ip\nbobby,10.90.9.9\nzoe42,10.90.9.9\n",
+			want:  "row 3",
+		},
+		{
+			name:  "missing column",
+			input: "bobby,10.90.9.9\nzoe\n",
+			want:  "row 2",
+		},
+		{
+			name:  "empty ip",
+			input: "bobby,\n",
+			want:  "row 1",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader(tc.input)))
+			err := config.CreateUsersFromCSV()
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Error %q does not mention %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestCreateUsersFromCSVMissingHeaderColumn(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("username,address\nbobby,10.90.9.9\n")
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsersFromCSV()
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
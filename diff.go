@@ -0,0 +1,175 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// UserChange is an entry whose username and ip address stayed the same
+// but whose other fields changed.
+type UserChange struct {
+	Old User `json:"old"`
+	New User `json:"new"`
+}
+
+// UserDiff lists who gained and lost access on which host between two
+// additional_users documents. Entries are matched by username and ip.
+type UserDiff struct {
+	Added   []User       `json:"added"`
+	Removed []User       `json:"removed"`
+	Changed []UserChange `json:"changed"`
+}
+
+type userKey struct {
+	username, ip string
+}
+
+func keyOf(u User) userKey {
+	return userKey{username: u.Username, ip: u.Ip}
+}
+
+// DiffUsers compares two documents. Removed and changed entries are in the
+// order of the old document, added entries in the order of the new one.
+func DiffUsers(old, new AdditionalUsers) UserDiff {
+	newUsers := indexUsers(new.Users)
+	diff := UserDiff{
+		Added:   []User{},
+		Removed: []User{},
+		Changed: []UserChange{},
+	}
+
+	seen := make(map[userKey]bool)
+	for _, u := range old.Users {
+		k := keyOf(u)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		n, ok := newUsers[k]
+		if !ok {
+			diff.Removed = append(diff.Removed, u)
+		} else if !n.equal(u) {
+			diff.Changed = append(diff.Changed, UserChange{Old: u, New: n})
+		}
+	}
+	for _, u := range new.Users {
+		k := keyOf(u)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		diff.Added = append(diff.Added, u)
+	}
+	return diff
+}
+
+// indexUsers maps each username and ip pair to its first entry.
+func indexUsers(users []User) map[userKey]User {
+	index := make(map[userKey]User, len(users))
+	for _, u := range users {
+		if _, ok := index[keyOf(u)]; !ok {
+			index[keyOf(u)] = u
+		}
+	}
+	return index
+}
+
+// Empty reports whether the documents had the same entries.
+func (d UserDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// WriteText writes the diff in a form meant for people reviewing it.
+func (d UserDiff) WriteText(w io.Writer) error {
+	for _, u := range d.Added {
+		fmt.Fprintf(w, "+ %v on %v\n", u.Username, u.Ip)
+	}
+	for _, u := range d.Removed {
+		fmt.Fprintf(w, "- %v on %v\n", u.Username, u.Ip)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(w, "~ %v on %v: %v\n", c.New.Username, c.New.Ip, strings.Join(changedFields(c.Old, c.New), ", "))
+	}
+	_, err := fmt.Fprintf(w, "%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+	return err
+}
+
+// WriteJSON writes the diff as an indented JSON object.
+func (d UserDiff) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
+
+// changedFields describes each field that differs between old and new.
+func changedFields(old, new User) []string {
+	var changes []string
+	field := func(name string, o, n any) {
+		changes = append(changes, fmt.Sprintf("%v %v -> %v", name, o, n))
+	}
+	if old.State != new.State {
+		field("state", quoteEmpty(old.State), quoteEmpty(new.State))
+	}
+	if !slices.Equal(old.Groups, new.Groups) {
+		field("groups", old.Groups, new.Groups)
+	}
+	if old.Shell != new.Shell {
+		field("shell", quoteEmpty(old.Shell), quoteEmpty(new.Shell))
+	}
+	if old.UID != new.UID {
+		field("uid", old.UID, new.UID)
+	}
+	if old.Home != new.Home {
+		field("home", quoteEmpty(old.Home), quoteEmpty(new.Home))
+	}
+	if old.HasSudo() != new.HasSudo() {
+		field("sudo", old.HasSudo(), new.HasSudo())
+	}
+	if old.Expires != new.Expires {
+		field("expires", quoteEmpty(old.Expires), quoteEmpty(new.Expires))
+	}
+	if !slices.Equal(old.SSHKeys, new.SSHKeys) {
+		field("ssh_authorized_keys", fmt.Sprintf("%d keys", len(old.SSHKeys)), fmt.Sprintf("%d keys", len(new.SSHKeys)))
+	}
+	return changes
+}
+
+func quoteEmpty(s string) string {
+	if s == "" {
+		return `""`
+	}
+	return s
+}
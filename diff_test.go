@@ -0,0 +1,92 @@
+package vmtools_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func loadUsers(t *testing.T, name string) vmtools.AdditionalUsers {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	users, err := vmtools.LoadAdditionalUsers(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return users
+}
+
+func TestDiffUsers(t *testing.T) {
+	t.Parallel()
+	old := loadUsers(t, "testdata/existing_users.yaml")
+	new := loadUsers(t, "testdata/new_users.yaml")
+	got := vmtools.DiffUsers(old, new)
+	want := vmtools.UserDiff{
+		Added:   []vmtools.User{{Username: "bobby", Ip: "10.90.9.9"}},
+		Removed: []vmtools.User{{Username: "zoe", Ip: "10.90.9.9"}},
+		Changed: []vmtools.UserChange{{
+			Old: vmtools.User{Username: "alice", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{Sudo: boolPtr(true)}},
+			New: vmtools.User{Username: "alice", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{Shell: "/bin/zsh"}},
+		}},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestDiffSameDocument(t *testing.T) {
+	t.Parallel()
+	users := loadUsers(t, "testdata/existing_users.yaml")
+	got := vmtools.DiffUsers(users, users)
+	if !got.Empty() {
+		t.Errorf("Expected empty diff, got %v", got)
+	}
+}
+
+func TestDiffText(t *testing.T) {
+	t.Parallel()
+	old := loadUsers(t, "testdata/existing_users.yaml")
+	new := loadUsers(t, "testdata/new_users.yaml")
+	var b bytes.Buffer
+	err := vmtools.DiffUsers(old, new).WriteText(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `+ bobby on 10.90.9.9
+- zoe on 10.90.9.9
+~ alice on 10.90.9.9: shell "" -> /bin/zsh, sudo true -> false
+1 added, 1 removed, 1 changed
+`
+	got := b.String()
+	if got != want {
+		t.Errorf("Got:\n%v\nWant:\n%v", got, want)
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	t.Parallel()
+	old := loadUsers(t, "testdata/existing_users.yaml")
+	new := loadUsers(t, "testdata/new_users.yaml")
+	var b bytes.Buffer
+	err := vmtools.DiffUsers(old, new).WriteJSON(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got vmtools.UserDiff
+	err = json.Unmarshal(b.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := vmtools.DiffUsers(old, new)
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
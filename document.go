@@ -0,0 +1,256 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UsersDocument is an additional_users file kept as a yaml node tree, so
+// that comments and other top-level keys survive edits to its users.
+type UsersDocument struct {
+	doc    *yaml.Node
+	header string
+	// offset is the number of lines in the header, to give line numbers
+	// in the file rather than in the document.
+	offset int
+}
+
+// NewUsersDocument returns a document with no users.
+func NewUsersDocument() *UsersDocument {
+	return &UsersDocument{doc: &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{
+		{Kind: yaml.MappingNode, Tag: "!!map"},
+	}}}
+}
+
+// LoadUsersDocument reads an existing additional_users file. Anything up
+// to a leading '---' line is taken to be the file's header and left out of
+// the document, as WriteYaml writes the header. An empty input gives an
+// empty document.
+func LoadUsersDocument(r io.Reader) (*UsersDocument, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	header, body := splitHeader(src)
+	offset := bytes.Count(src[:len(src)-len(body)], []byte("\n"))
+	var doc yaml.Node
+	err = yaml.Unmarshal(body, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		d := NewUsersDocument()
+		d.header = header
+		d.offset = offset
+		return d, nil
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("Users file must be a mapping with an 'additional_users' key")
+	}
+	return &UsersDocument{doc: &doc, header: header, offset: offset}, nil
+}
+
+// Header returns the header the file was loaded with, without its final
+// newline.
+func (d *UsersDocument) Header() string {
+	return d.header
+}
+
+// splitHeader splits off the blank lines, comments and '---' line that
+// come before the first line of content, if there is such a '---' line.
+func splitHeader(src []byte) (string, []byte) {
+	rest := src
+	for len(rest) > 0 {
+		line, after, _ := bytes.Cut(rest, []byte("\n"))
+		text := strings.TrimSpace(string(line))
+		switch {
+		case text == "---":
+			header := strings.TrimSuffix(string(src[:len(src)-len(after)]), "\n")
+			return header, after
+		case text == "" || strings.HasPrefix(text, "#"):
+			rest = after
+		default:
+			return "", src
+		}
+	}
+	return "", src
+}
+
+// usersNode returns the sequence of users, or nil if the document has
+// none. A null value is turned into an empty sequence.
+func (d *UsersDocument) usersNode() (*yaml.Node, error) {
+	node := mappingValue(d.doc.Content[0], "additional_users")
+	switch {
+	case node == nil:
+		return nil, nil
+	case node.Kind == yaml.ScalarNode && node.Tag == "!!null":
+		*node = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", LineComment: node.LineComment}
+	case node.Kind != yaml.SequenceNode:
+		return nil, fmt.Errorf("line %d: 'additional_users' must be a list", d.line(node))
+	}
+	return node, nil
+}
+
+// line returns the line of node in the file.
+func (d *UsersDocument) line(node *yaml.Node) int {
+	return node.Line + d.offset
+}
+
+// Users decodes every user in the document.
+func (d *UsersDocument) Users() ([]User, error) {
+	node, err := d.usersNode()
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, nil
+	}
+	users := make([]User, len(node.Content))
+	for i, item := range node.Content {
+		err = item.Decode(&users[i])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", d.line(item), err)
+		}
+	}
+	return users, nil
+}
+
+// MergeDocument merges c.Users into the document's users like MergeUsers,
+// leaving every other entry, comment and key as it was. Replaced entries
+// keep their comments. The new entries are added in the order set by
+// WithOrder. c.Users is set to all of the document's users.
+func (c *Config) MergeDocument(d *UsersDocument) (MergeResult, error) {
+	var result MergeResult
+	existing, err := d.Users()
+	if err != nil {
+		return result, err
+	}
+	added, err := c.orderUsers(c.Users)
+	if err != nil {
+		return result, err
+	}
+	node, _ := d.usersNode()
+	if node == nil {
+		node = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		top := d.doc.Content[0]
+		top.Content = append(top.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "additional_users"}, node)
+	}
+	users, result := mergeUsers(existing, added)
+	for i, u := range users {
+		if i < len(existing) && existing[i].equal(u) {
+			continue
+		}
+		var item yaml.Node
+		err = item.Encode(u)
+		if err != nil {
+			return result, err
+		}
+		if i < len(existing) {
+			old := node.Content[i]
+			item.HeadComment, item.LineComment, item.FootComment = old.HeadComment, old.LineComment, old.FootComment
+			node.Content[i] = &item
+			continue
+		}
+		node.Content = append(node.Content, &item)
+	}
+	if len(node.Content) > 0 {
+		node.Style &^= yaml.FlowStyle
+	}
+	c.Users = users
+	return result, nil
+}
+
+// RemoveFromDocument removes the entries matching c.Users from the
+// document like RemoveUsers. Comments on a removed entry go with it, apart
+// from a foot comment, which is kept on the entry before it. c.Users is set
+// to the document's remaining users.
+func (c *Config) RemoveFromDocument(d *UsersDocument) (RemoveResult, error) {
+	var result RemoveResult
+	existing, err := d.Users()
+	if err != nil {
+		return result, err
+	}
+	remove, notFound := matchUsers(existing, c.Users)
+	result.NotFound = notFound
+
+	var removed []User
+	c.Users, removed = d.removeEntries(existing, remove)
+	result.Removed = len(removed)
+	return result, nil
+}
+
+// removeEntries removes the entries marked in remove, keeping the foot
+// comment of each removed entry on the entry before it. existing are the
+// document's users, and the kept and removed ones are returned.
+func (d *UsersDocument) removeEntries(existing []User, remove []bool) ([]User, []User) {
+	node, _ := d.usersNode()
+	if node == nil {
+		return nil, nil
+	}
+	var kept, removed []User
+	var items []*yaml.Node
+	for i, item := range node.Content {
+		if !remove[i] {
+			kept = append(kept, existing[i])
+			items = append(items, item)
+			continue
+		}
+		removed = append(removed, existing[i])
+		if item.FootComment != "" && len(items) > 0 {
+			prev := items[len(items)-1]
+			prev.FootComment = strings.TrimPrefix(prev.FootComment+"\n"+item.FootComment, "\n")
+		}
+	}
+	node.Content = items
+	return kept, removed
+}
+
+// GenerateDocument renders the document with the indentation of c and
+// stores it in c.YamlString for WriteYaml.
+func (c *Config) GenerateDocument(d *UsersDocument) (string, error) {
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(c.indent)
+	err := encoder.Encode(d.doc)
+	if err != nil {
+		return "", err
+	}
+	encoder.Close()
+	c.YamlString = b.String()
+	return c.YamlString, nil
+}
@@ -0,0 +1,241 @@
+package vmtools_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func loadCommentedUsers(t *testing.T) *vmtools.UsersDocument {
+	t.Helper()
+	f, err := os.Open("testdata/commented_users.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := vmtools.LoadUsersDocument(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestMergeDocumentKeepsComments(t *testing.T) {
+	t.Parallel()
+	doc := loadCommentedUsers(t)
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("bobby zoe")))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := config.MergeDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult := vmtools.MergeResult{Added: 1, Present: 1}
+	if !cmp.Equal(result, wantResult) {
+		t.Error(cmp.Diff(result, wantResult))
+	}
+	if len(config.Users) != 3 {
+		t.Errorf("Expected 3 users, got %v", config.Users)
+	}
+	got, err := config.GenerateDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Reviewed in OPS-42
+additional_users:
+  # zoe is on call
+  - username: zoe
+    vm_ip: 10.90.9.9 # temporary
+  # alice needs sudo for deploys
+  - username: alice
+    vm_ip: 10.90.9.9
+    sudo: true
+  - username: bobby
+    vm_ip: 10.90.9.9
+# Not managed by create_users
+ansible_user: deploy
+`
+	if want != got {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestMergeDocumentReplacesChangedEntries(t *testing.T) {
+	t.Parallel()
+	doc := loadCommentedUsers(t)
+	defaults := vmtools.UserAttributes{Shell: "/bin/zsh"}
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("zoe")), vmtools.WithDefaults(defaults))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := config.MergeDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult := vmtools.MergeResult{Replaced: 1}
+	if !cmp.Equal(result, wantResult) {
+		t.Error(cmp.Diff(result, wantResult))
+	}
+	got, err := config.GenerateDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Reviewed in OPS-42
+additional_users:
+  # zoe is on call
+  - username: zoe
+    vm_ip: 10.90.9.9
+    shell: /bin/zsh
+  # alice needs sudo for deploys
+  - username: alice
+    vm_ip: 10.90.9.9
+    sudo: true
+# Not managed by create_users
+ansible_user: deploy
+`
+	if want != got {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestDocumentHeaderIsWrittenAsItIs(t *testing.T) {
+	t.Parallel()
+	input := "# deployed to {{ inventory_hostname }}\n---\nadditional_users:\n  - username: zoe\n    vm_ip: 10.90.9.9\n"
+	doc, err := vmtools.LoadUsersDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	config := vmtools.NewConfig(
+		vmtools.WithInput(strings.NewReader("bobby")),
+		vmtools.WithOutput(&b),
+		vmtools.WithLiteralHeader(doc.Header()),
+	)
+	err = config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.MergeDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.GenerateDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.WriteYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := input + "  - username: bobby\n    vm_ip: 10.90.9.9\n"
+	if got := b.String(); want != got {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRemoveFromDocumentKeepsComments(t *testing.T) {
+	t.Parallel()
+	doc := loadCommentedUsers(t)
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("zoe bobby")), vmtools.WithRevoke(true))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := config.RemoveFromDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult := vmtools.RemoveResult{Removed: 1, NotFound: 1}
+	if !cmp.Equal(result, wantResult) {
+		t.Error(cmp.Diff(result, wantResult))
+	}
+	got, err := config.GenerateDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Reviewed in OPS-42
+additional_users:
+  # alice needs sudo for deploys
+  - username: alice
+    vm_ip: 10.90.9.9
+    sudo: true
+# Not managed by create_users
+ansible_user: deploy
+`
+	if want != got {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRemoveEveryUserFromDocument(t *testing.T) {
+	t.Parallel()
+	doc := loadCommentedUsers(t)
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("zoe alice")), vmtools.WithRevoke(true))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.RemoveFromDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := config.GenerateDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Reviewed in OPS-42
+additional_users: []
+# Not managed by create_users
+ansible_user: deploy
+`
+	if want != got {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestMergeIntoEmptyDocument(t *testing.T) {
+	t.Parallel()
+	doc, err := vmtools.LoadUsersDocument(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("zoe")))
+	err = config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.MergeDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := config.GenerateDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffered, err := config.GenerateYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != buffered {
+		t.Error(cmp.Diff(buffered, got))
+	}
+}
+
+func TestLoadUsersDocumentRejectsOtherShapes(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{"- zoe\n", "additional_users: zoe\n"} {
+		doc, err := vmtools.LoadUsersDocument(strings.NewReader(input))
+		if err == nil {
+			_, err = doc.Users()
+		}
+		if err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"fmt"
+)
+
+// What to do with duplicates in the input.
+const (
+	// DuplicatesWarn drops duplicates and records them in Config.Duplicates.
+	DuplicatesWarn = "warn"
+	// DuplicatesFail returns every duplicate as a ValidationError.
+	DuplicatesFail = "fail"
+)
+
+// Kinds of Duplicate.
+const (
+	DuplicateUsername = "username"
+	DuplicateIP       = "ip address"
+	DuplicateEntry    = "entry"
+)
+
+// Duplicate is a username, ip address or username and ip pair that
+// appeared more than once in the input.
+type Duplicate struct {
+	Kind  string
+	Value string
+	// Source is where the repeat was found, and First where the value was
+	// first found.
+	Source string
+	First  string
+
+	pos inputPos
+}
+
+func (d Duplicate) String() string {
+	return fmt.Sprintf("%v: duplicate %v '%v', first seen at %v", d.Source, d.Kind, d.Value, d.First)
+}
+
+// WithDuplicates sets what happens to duplicates, either DuplicatesWarn
+// (the default) or DuplicatesFail.
+func WithDuplicates(mode string) func(*Config) {
+	return func(c *Config) {
+		c.duplicates = mode
+	}
+}
+
+func (c *Config) addDuplicate(kind, value string, pos, first inputPos) {
+	c.Duplicates = append(c.Duplicates, Duplicate{
+		Kind:   kind,
+		Value:  value,
+		Source: pos.source(),
+		First:  first.source(),
+		pos:    pos,
+	})
+}
+
+// duplicateError returns the duplicates found as errors if they aren't
+// allowed.
+func (c *Config) duplicateError() error {
+	if c.duplicates != DuplicatesFail || len(c.Duplicates) == 0 {
+		return nil
+	}
+	var errs ValidationErrors
+	for _, d := range c.Duplicates {
+		err := fmt.Errorf("duplicate %v '%v', first seen at %v", d.Kind, d.Value, d.First)
+		errs = append(errs, newValidationError(d.pos, d.Value, err))
+	}
+	return errs
+}
+
+// dedupeUsernames drops repeated usernames, comparing them as the username
+// policy writes them out.
+func (c *Config) dedupeUsernames(usernames []inputUser) []inputUser {
+	seen := make(map[string]inputPos)
+	var unique []inputUser
+	for _, w := range usernames {
+		name, err := c.policy.Validate(w.name)
+		if err != nil {
+			name = w.name
+		}
+		if first, ok := seen[name]; ok {
+			c.addDuplicate(DuplicateUsername, name, w.inputPos, first)
+			continue
+		}
+		seen[name] = w.inputPos
+		unique = append(unique, w)
+	}
+	return unique
+}
+
+// dedupeIPs drops repeated ip addresses, comparing them in their
+// normalised form.
+func (c *Config) dedupeIPs(ips []string) []string {
+	seen := make(map[string]inputPos)
+	var unique []string
+	for i, ip := range ips {
+		key := ip
+		if addr, err := ParseIP(ip); err == nil {
+			key = addr.String()
+		}
+		if first, ok := seen[key]; ok {
+			c.addDuplicate(DuplicateIP, key, ipPos(i+1), first)
+			continue
+		}
+		seen[key] = ipPos(i + 1)
+		unique = append(unique, ip)
+	}
+	return unique
+}
+
+// dedupeEntries drops entries with the same username and ip address as an
+// earlier one. positions holds where each entry came from.
+func (c *Config) dedupeEntries(users []User, positions []inputPos) []User {
+	seen := make(map[userKey]inputPos)
+	var unique []User
+	for i, u := range users {
+		if first, ok := seen[keyOf(u)]; ok {
+			c.addDuplicate(DuplicateEntry, u.Username+" on "+u.Ip, positions[i], first)
+			continue
+		}
+		seen[keyOf(u)] = positions[i]
+		unique = append(unique, u)
+	}
+	return unique
+}
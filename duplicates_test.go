@@ -0,0 +1,95 @@
+package vmtools_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func duplicateStrings(dups []vmtools.Duplicate) []string {
+	var s []string
+	for _, d := range dups {
+		s = append(s, d.String())
+	}
+	return s
+}
+
+func TestDuplicatesAreDroppedWithWarning(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("bobby zoe\nBobby")
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsers([]string{"10.90.9.9", "192.168.1.4", "::ffff:10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "bobby", Ip: "10.90.9.9"},
+		{Username: "zoe", Ip: "10.90.9.9"},
+		{Username: "bobby", Ip: "192.168.1.4"},
+		{Username: "zoe", Ip: "192.168.1.4"},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+	gotDups := duplicateStrings(config.Duplicates)
+	wantDups := []string{
+		"line 2, word 1: duplicate username 'bobby', first seen at line 1, word 1",
+		"ip 3: duplicate ip address '10.90.9.9', first seen at ip 1",
+	}
+	if !cmp.Equal(gotDups, wantDups) {
+		t.Error(cmp.Diff(gotDups, wantDups))
+	}
+}
+
+func TestDuplicatesFail(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("bobby zoe bobby")
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithDuplicates(vmtools.DuplicatesFail))
+	err := config.CreateUsers([]string{"10.90.9.9", "10.90.9.9"})
+	var errs vmtools.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected 2 errors, got %d:\n%v", len(errs), errs)
+	}
+}
+
+func TestDuplicateCSVEntries(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("bobby,10.90.9.9\nbobby,192.168.1.4\nBobby,10.90.9.9\n")
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsersFromCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vmtools.User{
+		{Username: "bobby", Ip: "10.90.9.9"},
+		{Username: "bobby", Ip: "192.168.1.4"},
+	}
+	if !cmp.Equal(config.Users, want) {
+		t.Error(cmp.Diff(config.Users, want))
+	}
+	gotDups := duplicateStrings(config.Duplicates)
+	wantDups := []string{"row 3: duplicate entry 'bobby on 10.90.9.9', first seen at row 1"}
+	if !cmp.Equal(gotDups, wantDups) {
+		t.Error(cmp.Diff(gotDups, wantDups))
+	}
+}
+
+func TestDuplicateMappingEntries(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("hosts:\n  10.90.9.9: [alice, bob, alice]\n")
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithDuplicates(vmtools.DuplicatesFail))
+	err := config.CreateUsersFromMapping()
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "first seen at line 2") {
+		t.Errorf("Error %q does not say where the first entry was", err)
+	}
+}
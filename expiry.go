@@ -0,0 +1,110 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseExpiry turns a date as YYYY-MM-DD, or a duration from now in days
+// ('30d') or weeks ('4w'), into the YYYY-MM-DD date used for Expires.
+func ParseExpiry(s string, now time.Time) (string, error) {
+	s = strings.TrimSpace(s)
+	if _, err := time.Parse(time.DateOnly, s); err == nil {
+		return s, nil
+	}
+	days := 1
+	switch {
+	case strings.HasSuffix(s, "d"):
+	case strings.HasSuffix(s, "w"):
+		days = 7
+	default:
+		return "", fmt.Errorf("Invalid expiry '%v', expected YYYY-MM-DD or a number of days (30d) or weeks (4w)", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("Invalid expiry '%v', expected YYYY-MM-DD or a number of days (30d) or weeks (4w)", s)
+	}
+	return now.AddDate(0, 0, n*days).Format(time.DateOnly), nil
+}
+
+// Expired reports whether the entry's expiry date has been reached at now,
+// in now's time zone. Entries without an expiry date never expire, and
+// neither do ones whose date is invalid, which PruneDocument reports.
+func (u User) Expired(now time.Time) bool {
+	if u.Expires == "" {
+		return false
+	}
+	expires, err := time.ParseInLocation(time.DateOnly, u.Expires, now.Location())
+	if err != nil {
+		return false
+	}
+	return !now.Before(expires)
+}
+
+// PruneDocument removes every entry of the document whose expiry date has
+// been reached, at the time given by the clock set with WithClock, and
+// returns them. Comments are handled like in RemoveFromDocument. c.Users
+// is set to the document's remaining users. If any expiry date is invalid,
+// nothing is removed and every invalid date is returned as a
+// ValidationErrors with its line in the file.
+func (c *Config) PruneDocument(d *UsersDocument) ([]User, error) {
+	existing, err := d.Users()
+	if err != nil {
+		return nil, err
+	}
+	var errs ValidationErrors
+	if node, _ := d.usersNode(); node != nil {
+		for i, u := range existing {
+			if u.Expires == "" {
+				continue
+			}
+			if _, err := time.Parse(time.DateOnly, u.Expires); err != nil {
+				err = fmt.Errorf("Invalid expiry date '%v', expected YYYY-MM-DD", u.Expires)
+				errs = append(errs, newValidationError(linePos(d.line(node.Content[i]), 0), u.Expires, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	now := c.now()
+	remove := make([]bool, len(existing))
+	for i, u := range existing {
+		remove[i] = u.Expired(now)
+	}
+	var removed []User
+	c.Users, removed = d.removeEntries(existing, remove)
+	return removed, nil
+}
@@ -0,0 +1,151 @@
+package vmtools_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+var expiryNow = time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+
+func TestParseExpiry(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"2024-12-31": "2024-12-31",
+		"30d":        "2024-03-31",
+		"0d":         "2024-03-01",
+		"2w":         "2024-03-15",
+	}
+	for input, want := range tests {
+		got, err := vmtools.ParseExpiry(input, expiryNow)
+		if err != nil {
+			t.Errorf("%v: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%v: got %v, want %v", input, got, want)
+		}
+	}
+	for _, input := range []string{"", "30", "-3d", "soon", "2024-02-30", "31/12/2024"} {
+		_, err := vmtools.ParseExpiry(input, expiryNow)
+		if err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestUserExpired(t *testing.T) {
+	t.Parallel()
+	tests := map[string]bool{
+		"":           false,
+		"2024-02-29": true,
+		"2024-03-01": true,
+		"2024-03-02": false,
+	}
+	for expires, want := range tests {
+		u := vmtools.User{Username: "carol", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{Expires: expires}}
+		if got := u.Expired(expiryNow); got != want {
+			t.Errorf("expires %q: got %v, want %v", expires, got, want)
+		}
+	}
+}
+
+func TestPruneDocument(t *testing.T) {
+	t.Parallel()
+	f, err := os.Open("testdata/expiring_users.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := vmtools.LoadUsersDocument(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Header() != "---" {
+		t.Errorf("Expected header '---', got %q", doc.Header())
+	}
+	config := vmtools.NewConfig(vmtools.WithClock(func() time.Time { return expiryNow }))
+	expired, err := config.PruneDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantExpired := []vmtools.User{{Username: "carol", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{Expires: "2024-03-01"}}}
+	if !cmp.Equal(expired, wantExpired) {
+		t.Error(cmp.Diff(wantExpired, expired))
+	}
+	got, err := config.GenerateDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `additional_users:
+  - username: zoe
+    vm_ip: 10.90.9.9
+  - username: dave
+    vm_ip: 10.90.9.9
+    expires: 2024-03-02
+`
+	if want != got {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestPruneDocumentReportsInvalidDates(t *testing.T) {
+	t.Parallel()
+	input := `# Managed by create_users
+---
+additional_users:
+  - username: carol
+    vm_ip: 10.90.9.9
+    expires: 2024-3-01
+  - username: dave
+    vm_ip: 10.90.9.9
+    expires: 2024-03-02
+`
+	doc, err := vmtools.LoadUsersDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := vmtools.NewConfig(vmtools.WithClock(func() time.Time { return expiryNow }))
+	_, err = config.PruneDocument(doc)
+	var invalid vmtools.ValidationErrors
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	want := "line 4: Invalid expiry date '2024-3-01', expected YYYY-MM-DD"
+	if len(invalid) != 1 || invalid[0].Error() != want {
+		t.Errorf("Expected %q, got %v", want, err)
+	}
+	users, err := doc.Users()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Errorf("Expected no users to be pruned, got %v", users)
+	}
+}
+
+func TestExpiresAttribute(t *testing.T) {
+	t.Parallel()
+	defaults := vmtools.UserAttributes{Expires: "2024-03-31"}
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("username,ip,expires\ncarol,10.90.9.9,2024-06-30\nzoe,10.90.9.9,\n")), vmtools.WithDefaults(defaults))
+	err := config.CreateUsersFromCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{config.Users[0].Expires, config.Users[1].Expires}
+	want := []string{"2024-06-30", "2024-03-31"}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	config = vmtools.NewConfig(vmtools.WithInput(strings.NewReader("carol")), vmtools.WithDefaults(vmtools.UserAttributes{Expires: "next week"}))
+	err = config.CreateUsers([]string{"10.90.9.9"})
+	if err == nil {
+		t.Error("Expected an error for an invalid expiry date")
+	}
+}
@@ -0,0 +1,247 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats accepted by WithFormat.
+const (
+	FormatYAML     = "yaml"
+	FormatYAMLFlow = "yaml-flow"
+	FormatJSON     = "json"
+	FormatTOML     = "toml"
+)
+
+func getFormats() []string {
+	return []string{FormatYAML, FormatYAMLFlow, FormatJSON, FormatTOML}
+}
+
+// WithFormat sets the format Generate renders users in. The default is
+// FormatYAML.
+func WithFormat(format string) func(*Config) {
+	return func(c *Config) {
+		c.format = format
+	}
+}
+
+// Generate renders c.Users in the format set by WithFormat, with the same
+// key names in every format, and stores it in c.YamlString for WriteYaml.
+// FormatYAMLFlow writes each user on one line in YAML flow style.
+func (c *Config) Generate() (string, error) {
+	if !slices.Contains(getFormats(), c.format) {
+		return "", fmt.Errorf("Unknown output format '%v'", c.format)
+	}
+	if c.format == FormatYAML {
+		return c.GenerateYaml()
+	}
+	users, err := c.orderUsers(c.Users)
+	if err != nil {
+		return "", err
+	}
+	if len(users) == 0 {
+		return "", errors.New("No users detected, empty output")
+	}
+
+	var out string
+	switch c.format {
+	case FormatYAMLFlow:
+		out, err = c.generateYamlFlow(users)
+	case FormatJSON:
+		out, err = c.generateJSON(users)
+	case FormatTOML:
+		out, err = c.generateTOML(users)
+	}
+	if err != nil {
+		return "", err
+	}
+	c.YamlString = out
+	return c.YamlString, nil
+}
+
+// usersNode encodes users as a yaml node, so every format shares the key
+// names and omitted fields of the yaml tags. Each user gets its group
+// comment as a head comment.
+func (c *Config) usersNode(users []User) (*yaml.Node, error) {
+	var node yaml.Node
+	err := node.Encode(AdditionalUsers{Users: users})
+	if err != nil {
+		return nil, err
+	}
+	items := mappingValue(&node, "additional_users").Content
+	for i, comment := range c.groupComments(users) {
+		items[i].HeadComment = comment
+	}
+	return &node, nil
+}
+
+func (c *Config) generateYamlFlow(users []User) (string, error) {
+	node, err := c.usersNode(users)
+	if err != nil {
+		return "", err
+	}
+	items := mappingValue(node, "additional_users")
+	for _, user := range items.Content {
+		user.Style = yaml.FlowStyle
+	}
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	defer encoder.Close()
+	encoder.SetIndent(c.indent)
+	err = encoder.Encode(node)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (c *Config) generateJSON(users []User) (string, error) {
+	b, err := json.MarshalIndent(AdditionalUsers{Users: users}, "", strings.Repeat(" ", c.indent))
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// generateTOML writes each user as a table in an array of tables.
+func (c *Config) generateTOML(users []User) (string, error) {
+	node, err := c.usersNode(users)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	items := mappingValue(node, "additional_users")
+	for i, user := range items.Content {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if user.HeadComment != "" {
+			b.WriteString(user.HeadComment + "\n")
+		}
+		b.WriteString("[[additional_users]]\n")
+		for j := 0; j+1 < len(user.Content); j += 2 {
+			value, err := tomlValue(user.Content[j+1])
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "%v = %v\n", user.Content[j].Value, value)
+		}
+	}
+	return b.String(), nil
+}
+
+// tomlValue renders a scalar or a sequence of scalars as a TOML value.
+func tomlValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!int", "!!bool":
+			return node.Value, nil
+		}
+		return tomlQuote(node.Value), nil
+	case yaml.SequenceNode:
+		values := make([]string, len(node.Content))
+		for i, item := range node.Content {
+			v, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			values[i] = v
+		}
+		return "[" + strings.Join(values, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("Cannot write line %d as TOML", node.Line)
+}
+
+// tomlQuote writes s as a TOML basic string.
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// formatHeader adapts a header to the output format. YAML headers are
+// written as given. TOML and JSON have no document marker, so '---' lines
+// are dropped, and TOML gets every other line as a comment. JSON has no
+// comments, so any other header is an error.
+func formatHeader(header string, format string) (string, error) {
+	switch format {
+	case FormatTOML, FormatJSON:
+	default:
+		return header, nil
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(header, "\n"), "\n") {
+		if strings.TrimSpace(line) == "---" {
+			continue
+		}
+		if format == FormatJSON {
+			if strings.TrimSpace(line) != "" {
+				return "", errors.New("JSON output cannot have a header")
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			line = strings.TrimRight("# "+line, " ")
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,148 @@
+package vmtools_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenerateFormats(t *testing.T) {
+	t.Parallel()
+	users := []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{Groups: []string{"docker", "wheel"}, Sudo: boolPtr(true)}},
+		{Username: "bob", Ip: "::1", State: vmtools.StateAbsent},
+	}
+	tests := map[string]string{
+		vmtools.FormatYAML: `additional_users:
+  - username: alice
+    vm_ip: 10.90.9.9
+    groups:
+      - docker
+      - wheel
+    sudo: true
+  - username: bob
+    vm_ip: ::1
+    state: absent
+`,
+		vmtools.FormatYAMLFlow: `additional_users:
+  - {username: alice, vm_ip: 10.90.9.9, groups: [docker, wheel], sudo: true}
+  - {username: bob, vm_ip: '::1', state: absent}
+`,
+		vmtools.FormatJSON: `{
+  "additional_users": [
+    {
+      "username": "alice",
+      "vm_ip": "10.90.9.9",
+      "groups": [
+        "docker",
+        "wheel"
+      ],
+      "sudo": true
+    },
+    {
+      "username": "bob",
+      "vm_ip": "::1",
+      "state": "absent"
+    }
+  ]
+}
+`,
+		vmtools.FormatTOML: `[[additional_users]]
+username = "alice"
+vm_ip = "10.90.9.9"
+groups = ["docker", "wheel"]
+sudo = true
+
+[[additional_users]]
+username = "bob"
+vm_ip = "::1"
+state = "absent"
+`,
+	}
+	for format, want := range tests {
+		config := vmtools.NewConfig(vmtools.WithFormat(format))
+		config.Users = users
+		got, err := config.Generate()
+		if err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+		if want != got {
+			t.Errorf("%v: %v", format, cmp.Diff(want, got))
+		}
+	}
+}
+
+func TestGenerateTOMLEscapes(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig(vmtools.WithFormat(vmtools.FormatTOML))
+	config.Users = []vmtools.User{{Username: "alice", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{
+		SSHKeys: []string{"ssh-ed25519 AAAA \"quoted\\path\""},
+	}}}
+	got, err := config.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[[additional_users]]
+username = "alice"
+vm_ip = "10.90.9.9"
+ssh_authorized_keys = ["ssh-ed25519 AAAA \"quoted\\path\""]
+`
+	if want != got {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestGenerateUnknownFormat(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig(vmtools.WithFormat("xml"))
+	config.Users = []vmtools.User{{Username: "alice", Ip: "10.90.9.9"}}
+	_, err := config.Generate()
+	if err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestWriteHeaderFormats(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		format string
+		header string
+		want   string
+		fails  bool
+	}{
+		{format: vmtools.FormatYAML, header: "---\n# managed", want: "---\n# managed\n"},
+		{format: vmtools.FormatTOML, header: "---\n# managed\ndo not edit", want: "# managed\n# do not edit\n"},
+		{format: vmtools.FormatTOML, header: "---", want: ""},
+		{format: vmtools.FormatJSON, header: "---", want: ""},
+		{format: vmtools.FormatJSON, header: "# managed", fails: true},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		config := vmtools.NewConfig(vmtools.WithFormat(tt.format), vmtools.WithHeader(tt.header), vmtools.WithOutput(&buf))
+		config.Users = []vmtools.User{{Username: "alice", Ip: "10.90.9.9"}}
+		body, err := config.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, headerErr := config.RenderHeader()
+		err = config.WriteYaml()
+		if tt.fails {
+			if err == nil || headerErr == nil {
+				t.Errorf("%v header %q: expected an error", tt.format, tt.header)
+			}
+			continue
+		}
+		if headerErr != nil || header != strings.TrimSuffix(tt.want, "\n") {
+			t.Errorf("%v header %q: RenderHeader gave %q, %v", tt.format, tt.header, header, headerErr)
+		}
+		if err != nil {
+			t.Fatalf("%v header %q: %v", tt.format, tt.header, err)
+		}
+		if got := buf.String(); got != tt.want+body {
+			t.Errorf("%v header %q: %v", tt.format, tt.header, cmp.Diff(tt.want+body, got))
+		}
+	}
+}
@@ -0,0 +1,174 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// HeaderContext is what a header template is executed with.
+type HeaderContext struct {
+	// User is the name of the user generating the file.
+	User string
+	// Date is when the file is generated.
+	Date time.Time
+	// Entries is the number of entries, Users the number of distinct
+	// usernames and Hosts the number of distinct ip addresses.
+	Entries int
+	Users   int
+	Hosts   int
+	// IPs are the distinct ip addresses, in the order they first appear.
+	IPs []string
+	// Vars are the variables set with WithHeaderVars.
+	Vars map[string]string
+}
+
+// WithHeaderVars sets variables that header templates can use as
+// {{.Vars.name}}.
+func WithHeaderVars(vars map[string]string) func(*Config) {
+	return func(c *Config) {
+		c.headerVars = vars
+	}
+}
+
+// WithLiteralHeader sets a header that is written as it is instead of
+// being executed as a template, such as the header of an existing file,
+// which may hold Jinja '{{ }}' expressions.
+func WithLiteralHeader(header string) func(*Config) {
+	return func(c *Config) {
+		c.Header = header
+		c.headerLiteral = true
+	}
+}
+
+// WithClock sets the function used to get the current time. It is
+// time.Now by default.
+func WithClock(now func() time.Time) func(*Config) {
+	return func(c *Config) {
+		c.now = now
+	}
+}
+
+// RenderHeader executes c.Header as a text/template with a HeaderContext
+// for c.Users, for example:
+//
+//	# Generated by {{.User}} on {{.Date.Format "2006-01-02"}} for {{.Vars.ticket}}
+//	# {{.Users}} users on {{.Hosts}} hosts: {{join .IPs ", "}}
+//
+// join is strings.Join. Using a variable that was not set is an error. A
+// header set with WithLiteralHeader is not executed. The header is
+// returned as WriteYaml writes it in the output format, so a header that
+// the format cannot have is an error.
+func (c *Config) RenderHeader() (string, error) {
+	return c.formattedHeader(c.headerContext())
+}
+
+func (c *Config) renderHeader(ctx HeaderContext) (string, error) {
+	if len(c.Header) == 0 || c.headerLiteral {
+		return c.Header, nil
+	}
+	tmpl, err := template.New("header").Funcs(template.FuncMap{"join": strings.Join}).Option("missingkey=error").Parse(c.Header)
+	if err != nil {
+		return "", fmt.Errorf("Invalid header template: %v", err)
+	}
+	var b strings.Builder
+	err = tmpl.Execute(&b, ctx)
+	if err != nil {
+		return "", fmt.Errorf("Cannot render header: %v", err)
+	}
+	return b.String(), nil
+}
+
+// headerContext describes c.Users.
+func (c *Config) headerContext() HeaderContext {
+	usernames := make(map[string]bool)
+	for _, u := range c.Users {
+		usernames[u.Username] = true
+	}
+	var ips []string
+	for _, h := range c.usersByHost() {
+		ips = append(ips, h.host)
+	}
+	return c.newHeaderContext(len(c.Users), len(usernames), ips)
+}
+
+func (c *Config) newHeaderContext(entries int, users int, ips []string) HeaderContext {
+	ctx := HeaderContext{
+		User:    currentUsername(),
+		Date:    c.now(),
+		Entries: entries,
+		Users:   users,
+		Hosts:   len(ips),
+		IPs:     ips,
+		Vars:    c.headerVars,
+	}
+	if ctx.Vars == nil {
+		ctx.Vars = map[string]string{}
+	}
+	return ctx
+}
+
+// formattedHeader renders the header for ctx in the output format.
+func (c *Config) formattedHeader(ctx HeaderContext) (string, error) {
+	header, err := c.renderHeader(ctx)
+	if err != nil {
+		return "", err
+	}
+	return formatHeader(header, c.format)
+}
+
+// writeHeader renders the header for ctx in the output format and writes
+// it to w, followed by a newline.
+func (c *Config) writeHeader(w io.Writer, ctx HeaderContext) error {
+	header, err := c.formattedHeader(ctx)
+	if err != nil {
+		return err
+	}
+	if len(header) > 0 {
+		_, err = io.WriteString(w, header+"\n")
+	}
+	return err
+}
+
+// currentUsername returns the name of the user running the program, or ""
+// if it cannot be found.
+func currentUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,104 @@
+package vmtools_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenderHeader(t *testing.T) {
+	t.Parallel()
+	header := `---
+# Generated on {{.Date.Format "2006-01-02"}} for ticket {{.Vars.ticket}}
+# {{.Users}} users on {{.Hosts}} hosts ({{.Entries}} entries): {{join .IPs ", "}}`
+	config := vmtools.NewConfig(
+		vmtools.WithHeader(header),
+		vmtools.WithHeaderVars(map[string]string{"ticket": "OPS-42"}),
+		vmtools.WithClock(func() time.Time {
+			return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		}),
+	)
+	config.Users = []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9"},
+		{Username: "bob", Ip: "10.90.9.9"},
+		{Username: "alice", Ip: "192.168.1.4"},
+	}
+	got, err := config.RenderHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `---
+# Generated on 2024-05-01 for ticket OPS-42
+# 2 users on 2 hosts (3 entries): 10.90.9.9, 192.168.1.4`
+	if want != got {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRenderHeaderErrors(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"unclosed action": "# {{.Users",
+		"unknown field":   "# {{.Tickets}}",
+		"unset variable":  "# {{.Vars.owner}}",
+	}
+	for name, header := range tests {
+		config := vmtools.NewConfig(
+			vmtools.WithHeader(header),
+			vmtools.WithHeaderVars(map[string]string{"ticket": "OPS-42"}),
+		)
+		config.Users = []vmtools.User{{Username: "alice", Ip: "10.90.9.9"}}
+		_, err := config.RenderHeader()
+		if err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
+
+func TestWriteYamlRendersHeader(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	config := vmtools.NewConfig(
+		vmtools.WithOutput(&buf),
+		vmtools.WithHeader("# {{.Vars.ticket}}"),
+		vmtools.WithHeaderVars(map[string]string{"ticket": "OPS-42"}),
+	)
+	config.Users = []vmtools.User{{Username: "alice", Ip: "10.90.9.9"}}
+	_, err := config.GenerateYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.WriteYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "# OPS-42\nadditional_users:\n") {
+		t.Errorf("Expected the rendered header, got:\n%v", buf.String())
+	}
+}
+
+func TestWriteYamlHeaderError(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	config := vmtools.NewConfig(
+		vmtools.WithOutput(&buf),
+		vmtools.WithHeader("# {{.Vars.owner}}"),
+		vmtools.WithHeaderVars(map[string]string{"ticket": "OPS-42"}),
+	)
+	config.Users = []vmtools.User{{Username: "alice", Ip: "10.90.9.9"}}
+	_, err := config.GenerateYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.WriteYaml()
+	if err == nil {
+		t.Error("Expected an error for an unset variable")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be written, got:\n%v", buf.String())
+	}
+}
@@ -0,0 +1,149 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mappingEntry is a user given as a mapping rather than a bare username.
+type mappingEntry struct {
+	Username       string `yaml:"username"`
+	UserAttributes `yaml:",inline"`
+}
+
+// CreateUsersFromMapping reads a document that lists the users for each
+// host, instead of giving every username every ip address:
+//
+//	defaults:
+//	  shell: /bin/bash
+//	hosts:
+//	  10.90.9.9: [alice, bob]
+//	  192.168.1.4:
+//	    - username: carol
+//	      groups: [docker]
+//	      sudo: true
+//
+// Users are either bare usernames or mappings that also set attributes.
+// The optional defaults apply to every user in the document. Every invalid
+// user is returned in ValidationErrors. JSON documents of the same shape
+// are accepted too. Hosts and users keep the order they have in the
+// document.
+func (c *Config) CreateUsersFromMapping() error {
+	var doc yaml.Node
+	err := yaml.NewDecoder(c.Input).Decode(&doc)
+	if err == io.EOF {
+		c.Users = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return errors.New("Host mapping must be a document with a 'hosts' key")
+	}
+	top := doc.Content[0]
+
+	hosts := mappingValue(top, "hosts")
+	if hosts == nil {
+		return errors.New("Host mapping has no 'hosts' key")
+	}
+	if hosts.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: 'hosts' must map each host to a list of users", hosts.Line)
+	}
+	var defaults UserAttributes
+	if node := mappingValue(top, "defaults"); node != nil {
+		err = node.Decode(&defaults)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid defaults: %v", node.Line, err)
+		}
+	}
+
+	var users []User
+	var positions []inputPos
+	var errs ValidationErrors
+	for i := 0; i < len(hosts.Content); i += 2 {
+		key, value := hosts.Content[i], hosts.Content[i+1]
+		if key.Kind != yaml.ScalarNode || key.Value == "" {
+			return fmt.Errorf("line %d: host must be an ip address", key.Line)
+		}
+		if value.Kind != yaml.SequenceNode {
+			return fmt.Errorf("line %d: users for host '%v' must be a list", value.Line, key.Value)
+		}
+		for _, node := range value.Content {
+			var entry mappingEntry
+			switch node.Kind {
+			case yaml.ScalarNode:
+				entry.Username = node.Value
+			case yaml.MappingNode:
+				err = node.Decode(&entry)
+				if err != nil {
+					return fmt.Errorf("line %d: %v", node.Line, err)
+				}
+			default:
+				return fmt.Errorf("line %d: user for host '%v' must be a username or a mapping", node.Line, key.Value)
+			}
+			u, err := c.newUser(entry.Username, key.Value, entry.UserAttributes.withDefaults(defaults))
+			if err != nil {
+				errs = append(errs, newValidationError(linePos(node.Line, 0), entry.Username, err))
+				continue
+			}
+			users = append(users, u)
+			positions = append(positions, linePos(node.Line, 0))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	c.Duplicates = nil
+	users = c.dedupeEntries(users, positions)
+	if err := c.duplicateError(); err != nil {
+		return err
+	}
+	c.Users = users
+	return nil
+}
+
+// mappingValue returns the value stored under key in a mapping node, or nil
+// if there is none.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package vmtools_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCreateUsersFromYamlMapping(t *testing.T) {
+	t.Parallel()
+	input, err := os.Open("testdata/hosts.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err = config.CreateUsersFromMapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9"},
+		{Username: "bob", Ip: "10.90.9.9"},
+		{Username: "carol", Ip: "192.168.1.4"},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestCreateUsersFromJsonMapping(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader(`{"hosts": {"192.168.1.4": ["Carol"], "10.90.9.9": ["alice"]}}`)
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsersFromMapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "carol", Ip: "192.168.1.4"},
+		{Username: "alice", Ip: "10.90.9.9"},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestCreateUsersFromMappingErrors(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name, input, want string
+	}{
+		{
+			name:  "invalid username",
+			input: "hosts:\n  10.90.9.9: [alice, bob2]\n",
+			want:  "line 2",
+		},
+		{
+			name:  "users not a list",
+			input: "hosts:\n  10.90.9.9: alice\n",
+			want:  "must be a list",
+		},
+		{
+			name:  "missing hosts key",
+			input: "users: [alice]\n",
+			want:  "no 'hosts' key",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader(tc.input)))
+			err := config.CreateUsersFromMapping()
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Error %q does not mention %q", err, tc.want)
+			}
+		})
+	}
+}
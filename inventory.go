@@ -0,0 +1,123 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Ansible inventory formats accepted by WriteInventory.
+const (
+	InventoryINI  = "ini"
+	InventoryYAML = "yaml"
+)
+
+// InventoryHost is one host of an inventory with the users it should have.
+type InventoryHost struct {
+	Host  string
+	Users []string
+}
+
+// InventoryHosts groups c.Users by ip address, in the order each address
+// first appears. Entries marked absent keep their host in the inventory
+// but are not listed as users of it.
+func (c *Config) InventoryHosts() []InventoryHost {
+	var hosts []InventoryHost
+	for _, h := range c.usersByHost() {
+		host := InventoryHost{Host: h.host, Users: []string{}}
+		for _, u := range h.users {
+			if u.State != StateAbsent {
+				host.Users = append(host.Users, u.Username)
+			}
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// WriteInventory writes an Ansible inventory with a host for every ip
+// address in c.Users. Each host gets a 'users' host variable listing the
+// usernames it should have.
+func (c *Config) WriteInventory(w io.Writer, format string) error {
+	hosts := c.InventoryHosts()
+	switch format {
+	case InventoryINI:
+		return writeInventoryINI(w, hosts)
+	case InventoryYAML:
+		return writeInventoryYAML(w, hosts, c.indent)
+	}
+	return fmt.Errorf("Unknown inventory format '%v'", format)
+}
+
+func writeInventoryINI(w io.Writer, hosts []InventoryHost) error {
+	for _, h := range hosts {
+		users, err := json.Marshal(h.Users)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%v users='%s'\n", h.Host, users)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeInventoryYAML(w io.Writer, hosts []InventoryHost, indent int) error {
+	hostsNode := &yaml.Node{Kind: yaml.MappingNode}
+	for _, h := range hosts {
+		users := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, u := range h.Users {
+			users.Content = append(users.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: u})
+		}
+		vars := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "users"}, users,
+		}}
+		hostsNode.Content = append(hostsNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: h.Host}, vars)
+	}
+	doc := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "all"},
+		{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "hosts"}, hostsNode,
+		}},
+	}}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(indent)
+	err := encoder.Encode(doc)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,90 @@
+package vmtools_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInventoryHosts(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig()
+	config.Users = []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9"},
+		{Username: "bob", Ip: "10.90.9.9"},
+		{Username: "alice", Ip: "192.168.1.4"},
+		{Username: "carol", Ip: "192.168.1.5", State: vmtools.StateAbsent},
+	}
+	got := config.InventoryHosts()
+	want := []vmtools.InventoryHost{
+		{Host: "10.90.9.9", Users: []string{"alice", "bob"}},
+		{Host: "192.168.1.4", Users: []string{"alice"}},
+		{Host: "192.168.1.5", Users: []string{}},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestWriteInventory(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			format: vmtools.InventoryINI,
+			want: `10.90.9.9 users='["alice","bob"]'
+192.168.1.4 users='["alice"]'
+192.168.1.5 users='[]'
+`,
+		},
+		{
+			format: vmtools.InventoryYAML,
+			want: `all:
+  hosts:
+    10.90.9.9:
+      users:
+        - alice
+        - bob
+    192.168.1.4:
+      users:
+        - alice
+    192.168.1.5:
+      users: []
+`,
+		},
+		{
+			format:  "toml",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.format, func(t *testing.T) {
+			config := vmtools.NewConfig()
+			config.Users = []vmtools.User{
+				{Username: "alice", Ip: "10.90.9.9"},
+				{Username: "bob", Ip: "10.90.9.9"},
+				{Username: "alice", Ip: "192.168.1.4"},
+				{Username: "carol", Ip: "192.168.1.5", State: vmtools.StateAbsent},
+			}
+			var buf bytes.Buffer
+			err := config.WriteInventory(&buf, tc.format)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Expected an error for an unknown inventory format")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); tc.want != got {
+				t.Error(cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
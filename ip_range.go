@@ -0,0 +1,163 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// DefaultMaxTargets is the largest number of addresses ExpandTargets will
+// produce unless told otherwise, so that a mistyped prefix like /8 fails
+// instead of generating millions of entries.
+const DefaultMaxTargets = 4096
+
+type TargetOptions struct {
+	// SkipNetworkBroadcast drops the network and broadcast addresses of
+	// IPv4 prefixes that have them (/30 and larger). IPv6 has no broadcast
+	// address, so IPv6 prefixes are always expanded whole.
+	SkipNetworkBroadcast bool
+	// MaxTargets caps the total number of addresses. Zero means
+	// DefaultMaxTargets.
+	MaxTargets int
+}
+
+// ExpandTargets turns a list of targets into a list of normalised ip
+// addresses. Each target can be a single address, a CIDR prefix such as
+// 10.0.0.0/29, or an inclusive range such as 10.0.0.5-10.0.0.20. Targets may
+// also be comma separated lists of any of these. Every invalid target is
+// returned in ValidationErrors, along with the addresses of the valid ones.
+func ExpandTargets(targets []string, opts TargetOptions) ([]string, error) {
+	limit := opts.MaxTargets
+	if limit <= 0 {
+		limit = DefaultMaxTargets
+	}
+	var ips []string
+	var errs ValidationErrors
+	n := 0
+	for _, target := range targets {
+		for _, t := range strings.Split(target, ",") {
+			t = strings.TrimSpace(t)
+			if t == "" {
+				continue
+			}
+			n++
+			var expanded []string
+			var err error
+			switch {
+			case strings.Contains(t, "/"):
+				expanded, err = expandPrefix(t, opts.SkipNetworkBroadcast, limit-len(ips))
+			case strings.Contains(t, "-"):
+				expanded, err = expandRange(t, limit-len(ips))
+			default:
+				var addr netip.Addr
+				addr, err = ParseIP(t)
+				expanded = []string{addr.String()}
+			}
+			if err != nil {
+				errs = append(errs, newValidationError(ipPos(n), t, err))
+				continue
+			}
+			ips = append(ips, expanded...)
+			if len(ips) > limit {
+				return nil, tooManyTargets(limit)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return ips, errs
+	}
+	return ips, nil
+}
+
+func tooManyTargets(limit int) error {
+	return fmt.Errorf("Targets expand to more than %d addresses", limit)
+}
+
+func expandPrefix(target string, skipNetworkBroadcast bool, limit int) ([]string, error) {
+	prefix, err := netip.ParsePrefix(target)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid prefix '%v': %v", target, err)
+	}
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits >= 31 {
+		return nil, fmt.Errorf("Prefix '%v' expands to more than %d addresses", target, limit)
+	}
+	size := 1 << hostBits
+	skipEnds := skipNetworkBroadcast && prefix.Addr().Is4() && hostBits >= 2
+	count := size
+	if skipEnds {
+		count -= 2
+	}
+	if count > limit {
+		return nil, fmt.Errorf("Prefix '%v' expands to more than %d addresses", target, limit)
+	}
+
+	var ips []string
+	addr := prefix.Addr()
+	for i := 0; i < size; i++ {
+		skip := skipEnds && (i == 0 || i == size-1)
+		if !skip {
+			ips = append(ips, addr.String())
+		}
+		addr = addr.Next()
+	}
+	return ips, nil
+}
+
+func expandRange(target string, limit int) ([]string, error) {
+	from, to, _ := strings.Cut(target, "-")
+	start, err := netip.ParseAddr(strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid range '%v': %v", target, err)
+	}
+	end, err := netip.ParseAddr(strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid range '%v': %v", target, err)
+	}
+	if start.Is4() != end.Is4() {
+		return nil, fmt.Errorf("Invalid range '%v': start and end must be the same address family", target)
+	}
+	if end.Less(start) {
+		return nil, fmt.Errorf("Invalid range '%v': end comes before start", target)
+	}
+
+	var ips []string
+	for addr := start; addr.IsValid() && !end.Less(addr); addr = addr.Next() {
+		if len(ips) == limit {
+			return nil, fmt.Errorf("Range '%v' expands to more than %d addresses", target, limit)
+		}
+		ips = append(ips, addr.String())
+	}
+	return ips, nil
+}
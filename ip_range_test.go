@@ -0,0 +1,125 @@
+package vmtools_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpandTargets(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name    string
+		targets []string
+		opts    vmtools.TargetOptions
+		want    []string
+	}{
+		{
+			name:    "single addresses",
+			targets: []string{"10.90.9.9", "192.168.1.4"},
+			want:    []string{"10.90.9.9", "192.168.1.4"},
+		},
+		{
+			name:    "prefix",
+			targets: []string{"10.0.0.0/30"},
+			want:    []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name:    "prefix without network and broadcast",
+			targets: []string{"10.0.0.0/29"},
+			opts:    vmtools.TargetOptions{SkipNetworkBroadcast: true},
+			want:    []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"},
+		},
+		{
+			name:    "skipped addresses do not count towards the cap",
+			targets: []string{"10.0.0.0/29"},
+			opts:    vmtools.TargetOptions{SkipNetworkBroadcast: true, MaxTargets: 6},
+			want:    []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"},
+		},
+		{
+			name:    "point to point prefix keeps both addresses",
+			targets: []string{"10.0.0.4/31"},
+			opts:    vmtools.TargetOptions{SkipNetworkBroadcast: true},
+			want:    []string{"10.0.0.4", "10.0.0.5"},
+		},
+		{
+			name:    "unmasked prefix",
+			targets: []string{"10.0.0.6/31"},
+			want:    []string{"10.0.0.6", "10.0.0.7"},
+		},
+		{
+			name:    "range",
+			targets: []string{"10.0.0.254-10.0.1.1"},
+			want:    []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"},
+		},
+		{
+			name:    "mixed comma separated list",
+			targets: []string{"10.0.0.1,10.0.1.0/31", "10.0.2.1-10.0.2.2"},
+			want:    []string{"10.0.0.1", "10.0.1.0", "10.0.1.1", "10.0.2.1", "10.0.2.2"},
+		},
+		{
+			name:    "ipv6 prefix",
+			targets: []string{"2001:db8::/127"},
+			opts:    vmtools.TargetOptions{SkipNetworkBroadcast: true},
+			want:    []string{"2001:db8::", "2001:db8::1"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := vmtools.ExpandTargets(tc.targets, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, tc.want) {
+				t.Error(cmp.Diff(got, tc.want))
+			}
+		})
+	}
+}
+
+func TestExpandTargetsErrors(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name    string
+		targets []string
+		opts    vmtools.TargetOptions
+	}{
+		{name: "slash 8 exceeds default cap", targets: []string{"10.0.0.0/8"}},
+		{name: "ipv6 slash 64", targets: []string{"2001:db8::/64"}},
+		{name: "range over cap", targets: []string{"10.0.0.1-10.0.0.20"}, opts: vmtools.TargetOptions{MaxTargets: 10}},
+		{name: "total over cap", targets: []string{"10.0.0.0/29", "10.0.1.0/29"}, opts: vmtools.TargetOptions{MaxTargets: 10}},
+		{name: "reversed range", targets: []string{"10.0.0.20-10.0.0.5"}},
+		{name: "mixed family range", targets: []string{"10.0.0.1-2001:db8::1"}},
+		{name: "invalid prefix", targets: []string{"10.0.0.0/33"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := vmtools.ExpandTargets(tc.targets, tc.opts)
+			if err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestExpandTargetsReportsEveryInvalidTarget(t *testing.T) {
+	t.Parallel()
+	got, err := vmtools.ExpandTargets([]string{"10.0.0.999,10.0.0.1", "10.0.0.0/33", "10.0.0.20-10.0.0.5"}, vmtools.TargetOptions{})
+	var invalid vmtools.ValidationErrors
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	var sources []string
+	for _, e := range invalid {
+		sources = append(sources, e.Source)
+	}
+	want := []string{"ip 1", "ip 3", "ip 4"}
+	if !cmp.Equal(sources, want) {
+		t.Error(cmp.Diff(want, sources))
+	}
+	if !cmp.Equal(got, []string{"10.0.0.1"}) {
+		t.Errorf("Expected the valid address, got %v", got)
+	}
+}
@@ -0,0 +1,310 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LDIFEntry is one entry of an LDIF file. Attribute names are lowercased
+// and any options such as ';binary' are dropped.
+type LDIFEntry struct {
+	DN         string
+	Attributes map[string][]string
+	Line       int
+}
+
+// Get returns the first value of an attribute, or "" if it has none.
+func (e LDIFEntry) Get(name string) string {
+	values := e.Attributes[strings.ToLower(name)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// HasObjectClass reports whether the entry has the given object class.
+func (e LDIFEntry) HasObjectClass(class string) bool {
+	for _, v := range e.Attributes["objectclass"] {
+		if strings.EqualFold(v, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGroup reports whether the entry is one of the group object classes
+// whose members can be resolved.
+func (e LDIFEntry) isGroup() bool {
+	return e.HasObjectClass("groupOfNames") || e.HasObjectClass("groupOfUniqueNames") || e.HasObjectClass("posixGroup")
+}
+
+// ldifLine is an unfolded LDIF line with the number of the line it started on.
+type ldifLine struct {
+	text string
+	line int
+}
+
+// ParseLDIF reads the entries of an LDIF file. Folded lines are joined,
+// comments are skipped and base64 values ('attr:: value') are decoded.
+func ParseLDIF(r io.Reader) ([]LDIFEntry, error) {
+	var lines []ldifLine
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	n := 0
+	comment := false
+	for scanner.Scan() {
+		n++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.HasPrefix(text, " ") {
+			if comment {
+				continue
+			}
+			if len(lines) == 0 || lines[len(lines)-1].text == "" {
+				return nil, fmt.Errorf("line %d: continuation line without a line to continue", n)
+			}
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+		comment = strings.HasPrefix(text, "#")
+		if comment {
+			continue
+		}
+		lines = append(lines, ldifLine{text: text, line: n})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var entries []LDIFEntry
+	var entry *LDIFEntry
+	for _, l := range lines {
+		if strings.TrimSpace(l.text) == "" {
+			entry = nil
+			continue
+		}
+		name, value, err := parseLDIFLine(l.text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", l.line, err)
+		}
+		if entry == nil {
+			if name == "version" && len(entries) == 0 {
+				continue
+			}
+			if name != "dn" {
+				return nil, fmt.Errorf("line %d: entry must start with 'dn', got '%v'", l.line, name)
+			}
+			entries = append(entries, LDIFEntry{DN: value, Attributes: make(map[string][]string), Line: l.line})
+			entry = &entries[len(entries)-1]
+			continue
+		}
+		entry.Attributes[name] = append(entry.Attributes[name], value)
+	}
+	return entries, nil
+}
+
+// parseLDIFLine splits an unfolded line into its attribute name and value.
+func parseLDIFLine(line string) (string, string, error) {
+	name, value, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("expected 'attribute: value', got '%v'", line)
+	}
+	name, _, _ = strings.Cut(strings.ToLower(name), ";")
+	switch {
+	case strings.HasPrefix(value, ":"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("invalid base64 value for '%v'", name)
+		}
+		return name, string(decoded), nil
+	case strings.HasPrefix(value, "<"):
+		return "", "", fmt.Errorf("URL value for '%v' is not supported", name)
+	}
+	return name, strings.TrimLeft(value, " "), nil
+}
+
+// normalizeDN lowercases a DN and removes the spaces around its separators,
+// so the same DN written in different ways compares equal.
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		attr, value, _ := strings.Cut(part, "=")
+		parts[i] = strings.TrimSpace(attr) + "=" + strings.TrimSpace(value)
+	}
+	return strings.ToLower(strings.Join(parts, ","))
+}
+
+// CreateUsersFromLDIF reads an LDIF export from c.Input and creates an
+// entry on every ip address for each member of the named group. The group
+// is matched by its cn or DN, and may be a groupOfNames or
+// groupOfUniqueNames with member DNs, or a posixGroup with memberUid
+// values. Members that are groups themselves are expanded, and a user in
+// several of them is only added once. If group is empty, every
+// posixAccount in the input is used.
+//
+// The username comes from the uid attribute of each posixAccount, and
+// uidNumber, loginShell, homeDirectory and sshPublicKey are carried over
+// when present. Members without a posixAccount entry in the input only get
+// a username.
+func (c *Config) CreateUsersFromLDIF(ips []string, group string) error {
+	entries, err := ParseLDIF(c.Input)
+	if err != nil {
+		return err
+	}
+	byDN := make(map[string]*LDIFEntry)
+	byUID := make(map[string]*LDIFEntry)
+	for i := range entries {
+		e := &entries[i]
+		byDN[normalizeDN(e.DN)] = e
+		if e.HasObjectClass("posixAccount") && e.Get("uid") != "" {
+			byUID[e.Get("uid")] = e
+		}
+	}
+
+	var usernames []inputUser
+	var errs ValidationErrors
+	add := func(account *LDIFEntry) {
+		attrs, err := ldifAttributes(*account)
+		if err != nil {
+			errs = append(errs, newValidationError(linePos(account.Line, 0), account.Get("uid"), err))
+			return
+		}
+		usernames = append(usernames, inputUser{name: account.Get("uid"), inputPos: linePos(account.Line, 0), attrs: attrs})
+	}
+
+	if group == "" {
+		for i := range entries {
+			if entries[i].HasObjectClass("posixAccount") {
+				add(&entries[i])
+			}
+		}
+	} else {
+		var g *LDIFEntry
+		for i := range entries {
+			e := &entries[i]
+			if e.isGroup() && (strings.EqualFold(e.Get("cn"), group) || normalizeDN(e.DN) == normalizeDN(group)) {
+				g = e
+				break
+			}
+		}
+		if g == nil {
+			return fmt.Errorf("Group '%v' not found in LDIF input", group)
+		}
+		// A user can be a member both directly and through nested
+		// groups, which is not a duplicate in the input.
+		members := make(map[string]bool)
+		isNew := func(uid string) bool {
+			if members[uid] {
+				return false
+			}
+			members[uid] = true
+			return true
+		}
+		var visit func(g *LDIFEntry, seen []*LDIFEntry)
+		visit = func(g *LDIFEntry, seen []*LDIFEntry) {
+			if slices.Contains(seen, g) {
+				return
+			}
+			seen = append(seen, g)
+			for _, uid := range g.Attributes["memberuid"] {
+				if !isNew(uid) {
+					continue
+				}
+				if account, ok := byUID[uid]; ok {
+					add(account)
+				} else {
+					usernames = append(usernames, inputUser{name: uid, inputPos: linePos(g.Line, 0)})
+				}
+			}
+			members := append(slices.Clone(g.Attributes["member"]), g.Attributes["uniquemember"]...)
+			for _, dn := range members {
+				member, ok := byDN[normalizeDN(dn)]
+				switch {
+				case ok && member.isGroup():
+					visit(member, seen)
+				case ok && member.HasObjectClass("posixAccount"):
+					if isNew(member.Get("uid")) {
+						add(member)
+					}
+				default:
+					uid, found := uidFromDN(dn)
+					if !found {
+						errs = append(errs, newValidationError(linePos(g.Line, 0), dn, errors.New("member is not a posixAccount in the input")))
+						continue
+					}
+					if isNew(uid) {
+						usernames = append(usernames, inputUser{name: uid, inputPos: linePos(g.Line, 0)})
+					}
+				}
+			}
+		}
+		visit(g, nil)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return c.createUsers(usernames, ips)
+}
+
+// ldifAttributes reads the user attributes of a posixAccount entry.
+func ldifAttributes(e LDIFEntry) (UserAttributes, error) {
+	var attrs UserAttributes
+	if v := e.Get("uidNumber"); v != "" {
+		uid, err := strconv.Atoi(v)
+		if err != nil {
+			return attrs, fmt.Errorf("Invalid uidNumber '%v'", v)
+		}
+		attrs.UID = uid
+	}
+	attrs.Shell = e.Get("loginShell")
+	attrs.Home = e.Get("homeDirectory")
+	for _, key := range e.Attributes["sshpublickey"] {
+		attrs.SSHKeys = append(attrs.SSHKeys, strings.TrimSpace(key))
+	}
+	return attrs, nil
+}
+
+// uidFromDN returns the value of a leading uid=... RDN.
+func uidFromDN(dn string) (string, bool) {
+	first, _, _ := strings.Cut(dn, ",")
+	attr, value, ok := strings.Cut(first, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(attr), "uid") {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
@@ -0,0 +1,139 @@
+package vmtools_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseLDIF(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("# comment\n dn: folded comment\ndn: uid=alice,dc=example\nuid: al\n ice\ncn:: QWxpY2UgU23DrXRo\n\ndn: uid=bob,dc=example\nuid: bob\n")
+	got, err := vmtools.ParseLDIF(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vmtools.LDIFEntry{
+		{DN: "uid=alice,dc=example", Attributes: map[string][]string{"uid": {"alice"}, "cn": {"Alice Smíth"}}, Line: 3},
+		{DN: "uid=bob,dc=example", Attributes: map[string][]string{"uid": {"bob"}}, Line: 8},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestParseLDIFErrors(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"no dn":        "uid: alice\n",
+		"bad base64":   "dn: uid=alice\nuid:: !!!\n",
+		"no separator": "dn: uid=alice\nuid alice\n",
+		"url value":    "dn: uid=alice\njpegPhoto:< file:///tmp/alice.jpg\n",
+	}
+	for name, input := range tests {
+		_, err := vmtools.ParseLDIF(strings.NewReader(input))
+		if err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
+
+func TestCreateUsersFromLDIFGroup(t *testing.T) {
+	t.Parallel()
+	input, err := os.Open("testdata/users.ldif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err = config.CreateUsersFromLDIF([]string{"10.90.9.9"}, "admins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{
+			UID:     1001,
+			Home:    "/home/alice",
+			Shell:   "/bin/bash",
+			SSHKeys: []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPj9ek6l6nzdLW221eRVo2dzS0bM/mMWELW9KZbT0IMA alice@laptop"},
+		}},
+		{Username: "bob", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{UID: 1002, Home: "/home/bob", Shell: "/bin/zsh"}},
+		{Username: "dave", Ip: "10.90.9.9"},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestCreateUsersFromLDIFOverlappingGroups(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader(`dn: uid=alice,ou=people,dc=example,dc=com
+objectClass: posixAccount
+uid: alice
+
+dn: cn=admins,ou=groups,dc=example,dc=com
+objectClass: groupOfNames
+cn: admins
+member: uid=alice,ou=people,dc=example,dc=com
+member: cn=ops,ou=groups,dc=example,dc=com
+
+dn: cn=ops,ou=groups,dc=example,dc=com
+objectClass: posixGroup
+cn: ops
+memberUid: alice
+memberUid: bob
+member: uid=bob,ou=people,dc=example,dc=com
+`)
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithDuplicates(vmtools.DuplicatesFail))
+	err := config.CreateUsersFromLDIF([]string{"10.90.9.9"}, "admins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vmtools.User{{Username: "alice", Ip: "10.90.9.9"}, {Username: "bob", Ip: "10.90.9.9"}}
+	if !cmp.Equal(config.Users, want) {
+		t.Error(cmp.Diff(want, config.Users))
+	}
+	if len(config.Duplicates) != 0 {
+		t.Errorf("Expected no duplicates, got %v", config.Duplicates)
+	}
+}
+
+func TestCreateUsersFromLDIFAllAccounts(t *testing.T) {
+	t.Parallel()
+	input, err := os.Open("testdata/users.ldif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err = config.CreateUsersFromLDIF([]string{"10.90.9.9"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, u := range config.Users {
+		got = append(got, u.Username)
+	}
+	want := []string{"alice", "bob", "carol"}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestCreateUsersFromLDIFUnknownGroup(t *testing.T) {
+	t.Parallel()
+	input, err := os.Open("testdata/users.ldif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err = config.CreateUsersFromLDIF([]string{"10.90.9.9"}, "nobody")
+	if err == nil {
+		t.Error("Expected an error for a group that is not in the input")
+	}
+}
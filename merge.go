@@ -0,0 +1,157 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MergeResult counts what happened to each user when merging.
+type MergeResult struct {
+	Added    int
+	Replaced int
+	Present  int
+}
+
+// LoadAdditionalUsers reads an existing additional_users document. An empty
+// input gives an empty document.
+func LoadAdditionalUsers(r io.Reader) (AdditionalUsers, error) {
+	var a AdditionalUsers
+	err := yaml.NewDecoder(r).Decode(&a)
+	if err == io.EOF {
+		return AdditionalUsers{}, nil
+	}
+	return a, err
+}
+
+// MergeUsers adds c.Users to the end of the existing users and stores the
+// result in c.Users. Existing entries keep their order. An existing entry
+// with the same username and ip address is replaced, or left as it is if
+// it already has the same fields.
+func (c *Config) MergeUsers(existing AdditionalUsers) MergeResult {
+	var result MergeResult
+	c.Users, result = mergeUsers(existing.Users, c.Users)
+	return result
+}
+
+// mergeUsers merges added into a copy of existing by username and ip
+// address. Only the first existing entry for a pair is matched, as in
+// DiffUsers. A replaced entry keeps its password hash, as the account
+// already has that password, and a new entry with a password gets the
+// hash its username already has, so that a user has the same password on
+// every host.
+func mergeUsers(existing, added []User) ([]User, MergeResult) {
+	var result MergeResult
+	users := make([]User, len(existing), len(existing)+len(added))
+	copy(users, existing)
+	index := make(map[userKey]int)
+	hashes := make(map[string]string)
+	for i, u := range users {
+		if _, ok := index[keyOf(u)]; !ok {
+			index[keyOf(u)] = i
+		}
+		if _, ok := hashes[u.Username]; !ok && u.Password != "" {
+			hashes[u.Username] = u.Password
+		}
+	}
+	for _, u := range added {
+		if hash, ok := hashes[u.Username]; ok && u.Password != "" {
+			u.Password = hash
+		}
+		i, ok := index[keyOf(u)]
+		switch {
+		case !ok:
+			index[keyOf(u)] = len(users)
+			users = append(users, u)
+			result.Added++
+		case users[i].equal(u):
+			result.Present++
+		default:
+			if users[i].Password != "" {
+				u.Password = users[i].Password
+			}
+			users[i] = u
+			result.Replaced++
+		}
+	}
+	return users, result
+}
+
+// RemoveResult counts what happened to each user when removing.
+type RemoveResult struct {
+	Removed  int
+	NotFound int
+}
+
+// RemoveUsers drops every existing entry with the same username and ip
+// address as one of c.Users, whatever its other fields, and stores the
+// remaining entries in c.Users.
+func (c *Config) RemoveUsers(existing AdditionalUsers) RemoveResult {
+	var result RemoveResult
+	remove, notFound := matchUsers(existing.Users, c.Users)
+	result.NotFound = notFound
+
+	var users []User
+	for i, e := range existing.Users {
+		if remove[i] {
+			result.Removed++
+			continue
+		}
+		users = append(users, e)
+	}
+	c.Users = users
+	return result
+}
+
+// matchUsers marks every existing entry with the same username and ip
+// address as one of users, and counts the users that match none.
+func matchUsers(existing, users []User) ([]bool, int) {
+	matches := make(map[userKey]bool)
+	for _, u := range users {
+		matches[keyOf(u)] = false
+	}
+	marked := make([]bool, len(existing))
+	for i, e := range existing {
+		if _, ok := matches[keyOf(e)]; ok {
+			marked[i] = true
+			matches[keyOf(e)] = true
+		}
+	}
+	notFound := 0
+	for _, u := range users {
+		if !matches[keyOf(u)] {
+			notFound++
+		}
+	}
+	return marked, notFound
+}
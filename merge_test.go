@@ -0,0 +1,183 @@
+package vmtools_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergeUsers(t *testing.T) {
+	t.Parallel()
+	f, err := os.Open("testdata/existing_users.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	existing, err := vmtools.LoadAdditionalUsers(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.NewReader("bobby zoe alice")
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err = config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := config.MergeUsers(existing)
+
+	wantResult := vmtools.MergeResult{Added: 1, Replaced: 1, Present: 1}
+	if !cmp.Equal(result, wantResult) {
+		t.Error(cmp.Diff(result, wantResult))
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "zoe", Ip: "10.90.9.9"},
+		{Username: "alice", Ip: "10.90.9.9"},
+		{Username: "bobby", Ip: "10.90.9.9"},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestMergeUsersIsIdempotent(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("bobby zoe")))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := config.Users
+	result := config.MergeUsers(vmtools.AdditionalUsers{Users: users})
+
+	want := vmtools.MergeResult{Added: 0, Present: 2}
+	if !cmp.Equal(result, want) {
+		t.Error(cmp.Diff(result, want))
+	}
+	if !cmp.Equal(config.Users, users) {
+		t.Error(cmp.Diff(config.Users, users))
+	}
+}
+
+func TestMergeUsersReplacesEntriesForTheSamePair(t *testing.T) {
+	t.Parallel()
+	existing := vmtools.AdditionalUsers{Users: []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9", State: vmtools.StateAbsent},
+		{Username: "zoe", Ip: "10.90.9.9", Password: "$6$salt$hash"},
+	}}
+	defaults := vmtools.UserAttributes{Shell: "/bin/zsh"}
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("alice zoe")), vmtools.WithDefaults(defaults))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := config.MergeUsers(existing)
+
+	wantResult := vmtools.MergeResult{Replaced: 2}
+	if !cmp.Equal(result, wantResult) {
+		t.Error(cmp.Diff(result, wantResult))
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9", UserAttributes: defaults},
+		{Username: "zoe", Ip: "10.90.9.9", UserAttributes: defaults, Password: "$6$salt$hash"},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestLoadEmptyAdditionalUsers(t *testing.T) {
+	t.Parallel()
+	got, err := vmtools.LoadAdditionalUsers(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Users) != 0 {
+		t.Errorf("Expected no users, got %v", got.Users)
+	}
+}
+
+func TestMergeUsersTreatsEmptyListsAsUnset(t *testing.T) {
+	t.Parallel()
+	defaults := vmtools.UserAttributes{Groups: []string{}}
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("zoe")), vmtools.WithDefaults(defaults))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := vmtools.AdditionalUsers{Users: []vmtools.User{{Username: "zoe", Ip: "10.90.9.9"}}}
+	got := config.MergeUsers(existing)
+	want := vmtools.MergeResult{Added: 0, Present: 1}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestRevokeCreatesAbsentEntries(t *testing.T) {
+	t.Parallel()
+	defaults := vmtools.UserAttributes{Shell: "/bin/bash"}
+	input := strings.NewReader("bobby")
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithRevoke(true), vmtools.WithDefaults(defaults))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := config.GenerateYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `additional_users:
+  - username: bobby
+    vm_ip: 10.90.9.9
+    state: absent
+`
+	if got != want {
+		t.Errorf("\nGot:\n%v\nWant:\n%v", got, want)
+	}
+}
+
+func TestRevokeValidatesInput(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("bobby2")
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithRevoke(true))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestRemoveUsers(t *testing.T) {
+	t.Parallel()
+	f, err := os.Open("testdata/existing_users.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	existing, err := vmtools.LoadAdditionalUsers(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.NewReader("alice bobby")
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithRevoke(true))
+	err = config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := config.RemoveUsers(existing)
+
+	wantResult := vmtools.RemoveResult{Removed: 1, NotFound: 1}
+	if !cmp.Equal(result, wantResult) {
+		t.Error(cmp.Diff(result, wantResult))
+	}
+	got := config.Users
+	want := []vmtools.User{{Username: "zoe", Ip: "10.90.9.9"}}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
@@ -0,0 +1,254 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// Collision strategies for NameGenerator.
+const (
+	// CollisionNumber adds 2, 3 and so on to a username that is taken.
+	CollisionNumber = "number"
+	// CollisionLetters uses more letters of the first or last name for
+	// patterns with {f} or {l}, and falls back to CollisionNumber.
+	CollisionLetters = "letters"
+)
+
+// getNamePatterns returns the preset patterns, by name.
+func getNamePatterns() map[string]string {
+	return map[string]string{
+		"flast":      "{f}{last}",
+		"firstl":     "{first}{l}",
+		"first.last": "{first}.{last}",
+		"first_last": "{first}_{last}",
+		"lastf":      "{last}{f}",
+		"first":      "{first}",
+	}
+}
+
+// transliterations maps accented Latin letters to ASCII.
+var transliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g", 'ĥ': "h", 'ħ': "h",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'ĳ': "ij", 'ĵ': "j", 'ķ': "k", 'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ŏ': "o", 'ő': "o",
+	'œ': "oe", 'ŕ': "r", 'ŗ': "r", 'ř': "r", 'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ß': "ss",
+	'ţ': "t", 'ť': "t", 'ŧ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ŵ': "w", 'ý': "y", 'ÿ': "y", 'ŷ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// Transliterate lower cases s and turns accented letters into ASCII.
+// Anything else that isn't an ASCII letter or digit is dropped.
+func Transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		case transliterations[r] != "":
+			b.WriteString(transliterations[r])
+		}
+	}
+	return b.String()
+}
+
+// NameGenerator turns full names into usernames that don't collide with
+// each other or with reserved names.
+type NameGenerator struct {
+	pattern   string
+	collision string
+	taken     map[string]bool
+	// policy, if set, is the policy every username must pass.
+	policy *UsernamePolicy
+}
+
+// NameMapping is a full name and the username generated for it.
+type NameMapping struct {
+	FullName string
+	Username string
+}
+
+// NewNameGenerator creates a generator for a preset such as "flast" or
+// "first.last", or for a pattern built from {first}, {last}, {f} (first
+// initial) and {l} (last initial).
+func NewNameGenerator(pattern string, collision string) (*NameGenerator, error) {
+	if preset, ok := getNamePatterns()[pattern]; ok {
+		pattern = preset
+	}
+	if !strings.Contains(pattern, "{") {
+		return nil, fmt.Errorf("Unknown name pattern '%v'", pattern)
+	}
+	if collision != CollisionNumber && collision != CollisionLetters {
+		return nil, fmt.Errorf("Unknown collision strategy '%v', expected '%v' or '%v'", collision, CollisionNumber, CollisionLetters)
+	}
+	return &NameGenerator{
+		pattern:   pattern,
+		collision: collision,
+		taken:     make(map[string]bool),
+	}, nil
+}
+
+// Reserve marks usernames as taken, such as accounts that already exist.
+func (g *NameGenerator) Reserve(usernames ...string) {
+	for _, name := range usernames {
+		g.taken[strings.ToLower(name)] = true
+	}
+}
+
+// SetPolicy makes the generator skip usernames that p doesn't allow.
+func (g *NameGenerator) SetPolicy(p UsernamePolicy) {
+	g.policy = &p
+}
+
+// allowed reports whether name passes the generator's policy.
+func (g *NameGenerator) allowed(name string) bool {
+	if g.policy == nil {
+		return true
+	}
+	_, err := g.policy.Validate(name)
+	return err == nil
+}
+
+// available reports whether name is free and allowed.
+func (g *NameGenerator) available(name string) bool {
+	return !g.taken[name] && g.allowed(name)
+}
+
+// Generate creates a username for fullName and marks it as taken. Middle
+// names are ignored. Usernames the policy set with SetPolicy doesn't allow
+// are skipped, and an error is returned if no allowed username is free.
+func (g *NameGenerator) Generate(fullName string) (string, error) {
+	var parts []string
+	for _, part := range strings.Fields(fullName) {
+		if p := Transliterate(part); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("Cannot make a username from '%v'", fullName)
+	}
+	first, last := parts[0], parts[len(parts)-1]
+	if len(parts) == 1 && (strings.Contains(g.pattern, "{last}") || strings.Contains(g.pattern, "{l}")) {
+		return "", fmt.Errorf("'%v' needs both a first and a last name", fullName)
+	}
+
+	name := g.expand(first, last, 1)
+	if g.collision == CollisionLetters {
+		longest := max(len(first), len(last))
+		for n := 2; !g.available(name) && n <= longest; n++ {
+			name = g.expand(first, last, n)
+		}
+		if !g.available(name) {
+			name = g.expand(first, last, 1)
+		}
+	}
+	if g.policy != nil {
+		if _, err := g.policy.Validate(name); err != nil {
+			return "", err
+		}
+	}
+	base := name
+	for i := 2; !g.available(name); i++ {
+		name = base + strconv.Itoa(i)
+		// Longer numbers won't be allowed either.
+		if !g.allowed(name) {
+			return "", fmt.Errorf("No username for '%v' is free and allowed by policy '%v'", fullName, g.policy.Name)
+		}
+	}
+	g.taken[name] = true
+	return name, nil
+}
+
+// expand fills in the pattern, using n letters for the initials.
+func (g *NameGenerator) expand(first, last string, n int) string {
+	return strings.NewReplacer(
+		"{first}", first,
+		"{last}", last,
+		"{f}", first[:min(n, len(first))],
+		"{l}", last[:min(n, len(last))],
+	).Replace(g.pattern)
+}
+
+// CreateUsersFromNames reads one full name per line from c.Input, turns
+// each into a username with g and creates an entry for it on every ip
+// address. g only generates usernames allowed by the policy of c.
+func (c *Config) CreateUsersFromNames(ips []string, g *NameGenerator) ([]NameMapping, error) {
+	g.Reserve(c.reservedNames()...)
+	g.SetPolicy(c.policy)
+	var mappings []NameMapping
+	var usernames []inputUser
+	var errs ValidationErrors
+	scanner := bufio.NewScanner(c.Input)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fullName := strings.TrimSpace(scanner.Text())
+		if fullName == "" {
+			continue
+		}
+		username, err := g.Generate(fullName)
+		if err != nil {
+			errs = append(errs, newValidationError(linePos(line, 0), fullName, err))
+			continue
+		}
+		mappings = append(mappings, NameMapping{FullName: fullName, Username: username})
+		usernames = append(usernames, inputUser{name: username, inputPos: linePos(line, 0)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return mappings, c.createUsers(usernames, ips)
+}
+
+// WriteNameMappings writes a table of each full name and its username.
+func WriteNameMappings(w io.Writer, mappings []NameMapping) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tUSERNAME")
+	for _, m := range mappings {
+		fmt.Fprintf(tw, "%v\t%v\n", m.FullName, m.Username)
+	}
+	return tw.Flush()
+}
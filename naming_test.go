@@ -0,0 +1,229 @@
+package vmtools_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTransliterate(t *testing.T) {
+	t.Parallel()
+	tcs := map[string]string{
+		"José":      "jose",
+		"García":    "garcia",
+		"Łukasz":    "lukasz",
+		"Søren":     "soren",
+		"Straße":    "strasse",
+		"O'Brien":   "obrien",
+		"Mary-Ann":  "maryann",
+		"Zoë":       "zoe",
+		"Ægir":      "aegir",
+		"Dvořák":    "dvorak",
+		"Ñúñez":     "nunez",
+		"Jean-Luc2": "jeanluc2",
+	}
+	for in, want := range tcs {
+		got := vmtools.Transliterate(in)
+		if got != want {
+			t.Errorf("Transliterate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestGenerateUsernames(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		pattern, collision string
+		names              []string
+		want               []string
+	}{
+		{
+			pattern:   "flast",
+			collision: vmtools.CollisionNumber,
+			names:     []string{"John Doe", "Jane Doe", "José García"},
+			want:      []string{"jdoe", "jdoe2", "jgarcia"},
+		},
+		{
+			pattern:   "flast",
+			collision: vmtools.CollisionLetters,
+			names:     []string{"John Doe", "Jane Doe", "Jane Doe"},
+			want:      []string{"jdoe", "jadoe", "jandoe"},
+		},
+		{
+			pattern:   "flast",
+			collision: vmtools.CollisionLetters,
+			names:     []string{"Al Li", "Al Li", "Al Li"},
+			want:      []string{"ali", "alli", "ali2"},
+		},
+		{
+			pattern:   "first.last",
+			collision: vmtools.CollisionLetters,
+			names:     []string{"John Ronald Doe", "John Doe"},
+			want:      []string{"john.doe", "john.doe2"},
+		},
+		{
+			pattern:   "{last}{f}{l}",
+			collision: vmtools.CollisionNumber,
+			names:     []string{"Søren Kierkegaard"},
+			want:      []string{"kierkegaardsk"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.pattern+" "+tc.collision, func(t *testing.T) {
+			g, err := vmtools.NewNameGenerator(tc.pattern, tc.collision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, name := range tc.names {
+				username, err := g.Generate(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, username)
+			}
+			if !cmp.Equal(got, tc.want) {
+				t.Error(cmp.Diff(got, tc.want))
+			}
+		})
+	}
+}
+
+func TestGenerateAvoidsReservedNames(t *testing.T) {
+	t.Parallel()
+	g, err := vmtools.NewNameGenerator("flast", vmtools.CollisionLetters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Reserve("jdoe")
+	got, err := g.Generate("John Doe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "jodoe" {
+		t.Errorf("Got %v, want jodoe", got)
+	}
+}
+
+func TestNameGeneratorErrors(t *testing.T) {
+	t.Parallel()
+	_, err := vmtools.NewNameGenerator("nope", vmtools.CollisionNumber)
+	if err == nil {
+		t.Error("Expected error for unknown pattern, got nil")
+	}
+	_, err = vmtools.NewNameGenerator("flast", "nope")
+	if err == nil {
+		t.Error("Expected error for unknown collision strategy, got nil")
+	}
+	g, err := vmtools.NewNameGenerator("flast", vmtools.CollisionNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.Generate("Cher")
+	if err == nil {
+		t.Error("Expected error for single name, got nil")
+	}
+	_, err = g.Generate("李 小龙")
+	if err == nil {
+		t.Error("Expected error for name without latin letters, got nil")
+	}
+}
+
+func TestCreateUsersFromNames(t *testing.T) {
+	t.Parallel()
+	input, err := os.Open("testdata/names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	g, err := vmtools.NewNameGenerator("flast", vmtools.CollisionLetters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	mappings, err := config.CreateUsersFromNames([]string{"10.90.9.9"}, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMappings := []vmtools.NameMapping{
+		{FullName: "John Doe", Username: "jdoe"},
+		{FullName: "José García", Username: "jgarcia"},
+		{FullName: "Jane Doe", Username: "jadoe"},
+		{FullName: "John Doe", Username: "jodoe"},
+		{FullName: "Mary-Ann O'Brien", Username: "mobrien"},
+	}
+	if !cmp.Equal(mappings, wantMappings) {
+		t.Error(cmp.Diff(mappings, wantMappings))
+	}
+	if len(config.Users) != 5 {
+		t.Errorf("Expected 5 users, got %v", config.Users)
+	}
+
+	var b bytes.Buffer
+	err = vmtools.WriteNameMappings(&b, mappings[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "NAME         USERNAME\nJohn Doe     jdoe\nJosé García  jgarcia\n"
+	if b.String() != want {
+		t.Errorf("Got:\n%q\nWant:\n%q", b.String(), want)
+	}
+}
+
+func TestCreateUsersFromNamesRespectsPolicy(t *testing.T) {
+	t.Parallel()
+	g, err := vmtools.NewNameGenerator("first.last", vmtools.CollisionNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("John Doe")))
+	_, err = config.CreateUsersFromNames([]string{"10.90.9.9"}, g)
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestCreateUsersFromNamesOnlyGeneratesAllowedNames(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		collision string
+		policy    vmtools.UsernamePolicy
+		want      []string
+		wantErr   bool
+	}{
+		{collision: vmtools.CollisionLetters, policy: vmtools.PolicyStrict, want: []string{"jdoe", "jadoe", "jandoe"}},
+		{collision: vmtools.CollisionNumber, policy: vmtools.PolicyStrict, wantErr: true},
+		{collision: vmtools.CollisionNumber, policy: vmtools.PolicyPOSIX, want: []string{"jdoe", "jdoe2", "jdoe3"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.collision+" "+tc.policy.Name, func(t *testing.T) {
+			g, err := vmtools.NewNameGenerator("flast", tc.collision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			input := strings.NewReader("John Doe\nJane Doe\nJane Doe\n")
+			config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithUsernamePolicy(tc.policy))
+			mappings, err := config.CreateUsersFromNames([]string{"10.90.9.9"}, g)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", mappings)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range mappings {
+				got = append(got, m.Username)
+			}
+			if !cmp.Equal(got, tc.want) {
+				t.Error(cmp.Diff(got, tc.want))
+			}
+		})
+	}
+}
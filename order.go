@@ -0,0 +1,153 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Orders accepted by WithOrder.
+const (
+	OrderInput    = "input"
+	OrderUsername = "username"
+	OrderIP       = "ip"
+)
+
+// Groupings accepted by WithGrouping.
+const (
+	GroupNone = "none"
+	GroupHost = "host"
+)
+
+func getOrders() []string {
+	return []string{OrderInput, OrderUsername, OrderIP}
+}
+
+func getGroupings() []string {
+	return []string{GroupNone, GroupHost}
+}
+
+// WithOrder sets the order entries are written in: OrderInput (the
+// default) keeps the order they were created in, OrderUsername sorts them
+// by username and OrderIP by ip address, numerically. Sorting is stable, so
+// entries that compare equal keep their order.
+func WithOrder(order string) func(*Config) {
+	return func(c *Config) {
+		c.order = order
+	}
+}
+
+// WithGrouping sets whether entries for the same host are written together.
+// With GroupHost, hosts come in the order they first appear, or in ip
+// order with OrderIP, and each host's entries are in the order set by
+// WithOrder. In yaml and toml output, each group starts with a comment
+// naming the host.
+func WithGrouping(group string) func(*Config) {
+	return func(c *Config) {
+		c.group = group
+	}
+}
+
+// checkOrder reports an unknown order or grouping.
+func (c *Config) checkOrder() error {
+	if !slices.Contains(getOrders(), c.order) {
+		return fmt.Errorf("Unknown order '%v'", c.order)
+	}
+	if !slices.Contains(getGroupings(), c.group) {
+		return fmt.Errorf("Unknown grouping '%v'", c.group)
+	}
+	return nil
+}
+
+// orderUsers returns a copy of users in the order and grouping set on c.
+func (c *Config) orderUsers(users []User) ([]User, error) {
+	if err := c.checkOrder(); err != nil {
+		return nil, err
+	}
+	// Hosts are grouped in the order they first appear in the input.
+	rank := make(map[string]int)
+	for _, u := range users {
+		if _, ok := rank[u.Ip]; !ok {
+			rank[u.Ip] = len(rank)
+		}
+	}
+	users = slices.Clone(users)
+	switch c.order {
+	case OrderUsername:
+		slices.SortStableFunc(users, func(a, b User) int {
+			return strings.Compare(a.Username, b.Username)
+		})
+	case OrderIP:
+		slices.SortStableFunc(users, func(a, b User) int {
+			return compareIPs(a.Ip, b.Ip)
+		})
+	}
+	if c.group == GroupHost && c.order != OrderIP {
+		slices.SortStableFunc(users, func(a, b User) int {
+			return rank[a.Ip] - rank[b.Ip]
+		})
+	}
+	return users, nil
+}
+
+// groupComments returns the comment to put before each of users, which
+// are in the order from orderUsers.
+func (c *Config) groupComments(users []User) []string {
+	comments := make([]string, len(users))
+	if c.group != GroupHost {
+		return comments
+	}
+	for i, u := range users {
+		if i == 0 || users[i-1].Ip != u.Ip {
+			comments[i] = "# " + u.Ip
+		}
+	}
+	return comments
+}
+
+// compareIPs compares ip addresses numerically, with IPv4 before IPv6.
+// Anything that is not an ip address sorts after them, as text.
+func compareIPs(a, b string) int {
+	addrA, errA := netip.ParseAddr(a)
+	addrB, errB := netip.ParseAddr(b)
+	switch {
+	case errA == nil && errB == nil:
+		return addrA.Compare(addrB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
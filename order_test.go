@@ -0,0 +1,166 @@
+package vmtools_test
+
+import (
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenerateOrder(t *testing.T) {
+	t.Parallel()
+	users := []vmtools.User{
+		{Username: "zoe", Ip: "10.0.0.10"},
+		{Username: "alice", Ip: "10.0.0.9"},
+		{Username: "bobby", Ip: "10.0.0.10"},
+		{Username: "alice", Ip: "10.0.0.10"},
+		{Username: "zoe", Ip: "2001:db8::1"},
+		{Username: "bobby", Ip: "10.0.0.9"},
+	}
+	tests := []struct {
+		order string
+		group string
+		want  string
+	}{
+		{order: vmtools.OrderInput, group: vmtools.GroupNone, want: `additional_users:
+  - username: zoe
+    vm_ip: 10.0.0.10
+  - username: alice
+    vm_ip: 10.0.0.9
+  - username: bobby
+    vm_ip: 10.0.0.10
+  - username: alice
+    vm_ip: 10.0.0.10
+  - username: zoe
+    vm_ip: 2001:db8::1
+  - username: bobby
+    vm_ip: 10.0.0.9
+`},
+		{order: vmtools.OrderUsername, group: vmtools.GroupNone, want: `additional_users:
+  - username: alice
+    vm_ip: 10.0.0.9
+  - username: alice
+    vm_ip: 10.0.0.10
+  - username: bobby
+    vm_ip: 10.0.0.10
+  - username: bobby
+    vm_ip: 10.0.0.9
+  - username: zoe
+    vm_ip: 10.0.0.10
+  - username: zoe
+    vm_ip: 2001:db8::1
+`},
+		{order: vmtools.OrderIP, group: vmtools.GroupNone, want: `additional_users:
+  - username: alice
+    vm_ip: 10.0.0.9
+  - username: bobby
+    vm_ip: 10.0.0.9
+  - username: zoe
+    vm_ip: 10.0.0.10
+  - username: bobby
+    vm_ip: 10.0.0.10
+  - username: alice
+    vm_ip: 10.0.0.10
+  - username: zoe
+    vm_ip: 2001:db8::1
+`},
+		{order: vmtools.OrderUsername, group: vmtools.GroupHost, want: `additional_users:
+  # 10.0.0.10
+  - username: alice
+    vm_ip: 10.0.0.10
+  - username: bobby
+    vm_ip: 10.0.0.10
+  - username: zoe
+    vm_ip: 10.0.0.10
+  # 10.0.0.9
+  - username: alice
+    vm_ip: 10.0.0.9
+  - username: bobby
+    vm_ip: 10.0.0.9
+  # 2001:db8::1
+  - username: zoe
+    vm_ip: 2001:db8::1
+`},
+	}
+	for _, tt := range tests {
+		config := vmtools.NewConfig(vmtools.WithOrder(tt.order), vmtools.WithGrouping(tt.group))
+		config.Users = users
+		got, err := config.GenerateYaml()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.want != got {
+			t.Errorf("order %v, group %v: %v", tt.order, tt.group, cmp.Diff(tt.want, got))
+		}
+	}
+}
+
+func TestGenerateOrderTOMLComments(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig(
+		vmtools.WithOrder(vmtools.OrderIP),
+		vmtools.WithGrouping(vmtools.GroupHost),
+		vmtools.WithFormat(vmtools.FormatTOML),
+	)
+	config.Users = []vmtools.User{
+		{Username: "zoe", Ip: "10.0.0.10"},
+		{Username: "alice", Ip: "10.0.0.9"},
+	}
+	got, err := config.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# 10.0.0.9
+[[additional_users]]
+username = "alice"
+vm_ip = "10.0.0.9"
+
+# 10.0.0.10
+[[additional_users]]
+username = "zoe"
+vm_ip = "10.0.0.10"
+`
+	if want != got {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestGenerateOrderLeavesUsers(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig(vmtools.WithOrder(vmtools.OrderUsername))
+	config.Users = []vmtools.User{
+		{Username: "zoe", Ip: "10.0.0.10"},
+		{Username: "alice", Ip: "10.0.0.9"},
+		{Username: "bobby", Ip: "10.0.0.10"},
+		{Username: "alice", Ip: "10.0.0.10"},
+		{Username: "zoe", Ip: "2001:db8::1"},
+		{Username: "bobby", Ip: "10.0.0.9"},
+	}
+	before := config.Users
+	_, err := config.GenerateYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Users[0].Username != "zoe" || !cmp.Equal(config.Users, before) {
+		t.Errorf("Expected c.Users to keep its order, got %v", config.Users)
+	}
+}
+
+func TestGenerateUnknownOrder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		order string
+		group string
+	}{
+		{order: "size", group: vmtools.GroupNone},
+		{order: vmtools.OrderIP, group: "rack"},
+	}
+	for _, tt := range tests {
+		config := vmtools.NewConfig(vmtools.WithOrder(tt.order), vmtools.WithGrouping(tt.group))
+		config.Users = []vmtools.User{{Username: "zoe", Ip: "10.0.0.10"}}
+		_, err := config.GenerateYaml()
+		if err == nil {
+			t.Errorf("order %v, group %v: expected an error", tt.order, tt.group)
+		}
+	}
+}
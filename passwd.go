@@ -0,0 +1,130 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PasswdEntry is one line of a passwd file, as printed by 'getent passwd'.
+type PasswdEntry struct {
+	Username string
+	UID      int
+	GID      int
+	Gecos    string
+	Home     string
+	Shell    string
+	Line     int
+}
+
+// ParsePasswd reads passwd format lines. Blank lines, comments and NIS
+// compat lines starting with '+' or '-' are skipped.
+func ParsePasswd(r io.Reader) ([]PasswdEntry, error) {
+	var entries []PasswdEntry
+	var errs ValidationErrors
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "+") || strings.HasPrefix(text, "-") {
+			continue
+		}
+		entry, err := parsePasswdLine(text)
+		if err != nil {
+			errs = append(errs, newValidationError(linePos(line, 0), text, err))
+			continue
+		}
+		entry.Line = line
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return entries, nil
+}
+
+func parsePasswdLine(line string) (PasswdEntry, error) {
+	fields := strings.Split(line, ":")
+	if len(fields) != 7 {
+		return PasswdEntry{}, fmt.Errorf("expected 7 fields, got %d", len(fields))
+	}
+	if fields[0] == "" {
+		return PasswdEntry{}, errors.New("empty username")
+	}
+	uid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return PasswdEntry{}, fmt.Errorf("Invalid uid '%v'", fields[2])
+	}
+	gid, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return PasswdEntry{}, fmt.Errorf("Invalid gid '%v'", fields[3])
+	}
+	return PasswdEntry{
+		Username: fields[0],
+		UID:      uid,
+		GID:      gid,
+		Gecos:    fields[4],
+		Home:     fields[5],
+		Shell:    fields[6],
+	}, nil
+}
+
+// CreateUsersFromPasswd reads passwd format lines from c.Input and creates
+// an entry on every ip address for each account whose UID is in the range
+// set by WithUIDRange, which leaves out system accounts. The UID, home
+// directory and shell of each account are carried over.
+func (c *Config) CreateUsersFromPasswd(ips []string) error {
+	entries, err := ParsePasswd(c.Input)
+	if err != nil {
+		return err
+	}
+	var usernames []inputUser
+	for _, e := range entries {
+		if e.UID < c.uidMin || e.UID > c.uidMax {
+			continue
+		}
+		usernames = append(usernames, inputUser{
+			name:     e.Username,
+			inputPos: linePos(e.Line, 0),
+			attrs:    UserAttributes{UID: e.UID, Home: e.Home, Shell: e.Shell},
+		})
+	}
+	return c.createUsers(usernames, ips)
+}
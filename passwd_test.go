@@ -0,0 +1,84 @@
+package vmtools_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePasswd(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("# comment\njohndoe:x:1000:1000:John Doe,,,:/home/johndoe:/bin/bash\n")
+	got, err := vmtools.ParsePasswd(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vmtools.PasswdEntry{{
+		Username: "johndoe",
+		UID:      1000,
+		GID:      1000,
+		Gecos:    "John Doe,,,",
+		Home:     "/home/johndoe",
+		Shell:    "/bin/bash",
+		Line:     2,
+	}}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestParsePasswdErrors(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("johndoe:x:1000:1000::/home/johndoe\njanedoe:x:abc:1001::/home/janedoe:/bin/bash\n")
+	_, err := vmtools.ParsePasswd(input)
+	var errs vmtools.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	if len(errs) != 2 || errs[0].Line != 1 || errs[1].Line != 2 {
+		t.Errorf("Expected errors on lines 1 and 2, got:\n%v", errs)
+	}
+}
+
+func TestCreateUsersFromPasswd(t *testing.T) {
+	t.Parallel()
+	input, err := os.Open("testdata/passwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err = config.CreateUsersFromPasswd([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Users
+	want := []vmtools.User{
+		{Username: "johndoe", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{UID: 1000, Home: "/home/johndoe", Shell: "/bin/bash"}},
+		{Username: "janedoe", Ip: "10.90.9.9", UserAttributes: vmtools.UserAttributes{UID: 1001, Home: "/home/janedoe", Shell: "/bin/zsh"}},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestCreateUsersFromPasswdUIDRange(t *testing.T) {
+	t.Parallel()
+	input, err := os.Open("testdata/passwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithUIDRange(1001, 2000))
+	err = config.CreateUsersFromPasswd([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Users) != 1 || config.Users[0].Username != "janedoe" {
+		t.Errorf("Expected only janedoe, got %v", config.Users)
+	}
+}
@@ -0,0 +1,143 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// PasswordLength is the length of generated initial passwords.
+const PasswordLength = 20
+
+// passwordAlphabet leaves out characters that are easily mistaken for
+// each other.
+const passwordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// InitialPassword is the plaintext password generated for a user, with
+// the hash stored in their entries.
+type InitialPassword struct {
+	Username string
+	Password string
+	Hash     string
+}
+
+// WithRandom sets the source of randomness for passwords and salts. It is
+// crypto/rand.Reader by default.
+func WithRandom(r io.Reader) func(*Config) {
+	return func(c *Config) {
+		c.random = r
+	}
+}
+
+// GeneratePasswords gives every user in c.Users a random initial password,
+// the same one on every host, and stores its SHA-512 crypt hash in the
+// Password field of their entries. Users marked absent get none. The
+// plaintext passwords are returned in the order users first appear, and
+// are never part of the generated output.
+func (c *Config) GeneratePasswords() ([]InitialPassword, error) {
+	var passwords []InitialPassword
+	hashes := make(map[string]string)
+	for i, u := range c.Users {
+		if u.State == StateAbsent {
+			continue
+		}
+		hash, ok := hashes[u.Username]
+		if !ok {
+			password, err := c.randomString(PasswordLength, passwordAlphabet)
+			if err != nil {
+				return nil, err
+			}
+			salt, err := c.randomString(sha512CryptMaxSalt, cryptAlphabet)
+			if err != nil {
+				return nil, err
+			}
+			hash = SHA512Crypt(password, salt)
+			hashes[u.Username] = hash
+			passwords = append(passwords, InitialPassword{Username: u.Username, Password: password, Hash: hash})
+		}
+		c.Users[i].Password = hash
+	}
+	return passwords, nil
+}
+
+// randomString returns n characters picked uniformly from alphabet.
+func (c *Config) randomString(n int, alphabet string) (string, error) {
+	// Bytes at or above limit would make the first characters more likely.
+	limit := 256 - 256%len(alphabet)
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		_, err := io.ReadFull(c.random, buf)
+		if err != nil {
+			return "", fmt.Errorf("Cannot generate password: %v", err)
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(out) < n {
+				out = append(out, alphabet[int(b)%len(alphabet)])
+			}
+		}
+	}
+	return string(out), nil
+}
+
+// WritePasswords writes one 'username:password' line for each password,
+// the format chpasswd reads.
+func WritePasswords(w io.Writer, passwords []InitialPassword) error {
+	for _, p := range passwords {
+		_, err := fmt.Fprintf(w, "%v:%v\n", p.Username, p.Password)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePasswordFile writes the passwords to path with WritePasswords. The
+// file is only readable and writable by its owner.
+func WritePasswordFile(path string, passwords []InitialPassword) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// OpenFile keeps the permissions of a file that already exists.
+	err = f.Chmod(0600)
+	if err != nil {
+		return err
+	}
+	err = WritePasswords(f, passwords)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
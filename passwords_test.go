@@ -0,0 +1,153 @@
+package vmtools_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+// countingReader returns 0, 1, 2, ... so generated passwords are fixed.
+type countingReader struct{ n byte }
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.n
+		r.n++
+	}
+	return len(p), nil
+}
+
+func TestGeneratePasswords(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig(vmtools.WithRandom(&countingReader{}))
+	config.Users = []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9"},
+		{Username: "bobby", Ip: "10.90.9.9", State: vmtools.StateAbsent},
+		{Username: "alice", Ip: "192.168.1.4"},
+	}
+	passwords, err := config.GeneratePasswords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passwords) != 1 || passwords[0].Username != "alice" || len(passwords[0].Password) != vmtools.PasswordLength {
+		t.Fatalf("Expected one password for alice, got %v", passwords)
+	}
+	hash := config.Users[0].Password
+	if passwords[0].Hash != hash {
+		t.Errorf("Expected the returned hash %v to be stored, got %v", passwords[0].Hash, hash)
+	}
+	if config.Users[2].Password != hash {
+		t.Errorf("Expected the same hash on every host, got %v and %v", hash, config.Users[2].Password)
+	}
+	if config.Users[1].Password != "" {
+		t.Errorf("Expected no password for an absent user, got %v", config.Users[1].Password)
+	}
+	salt := strings.Split(hash, "$")[2]
+	if got := vmtools.SHA512Crypt(passwords[0].Password, salt); got != hash {
+		t.Errorf("Hash does not match the password:\nGot:  %v\nWant: %v", got, hash)
+	}
+
+	out, err := config.GenerateYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, passwords[0].Password) {
+		t.Error("Plaintext password found in the generated yaml")
+	}
+	if !strings.Contains(out, "password: $6$"+salt+"$") {
+		t.Errorf("Expected the password hash in the generated yaml, got:\n%v", out)
+	}
+}
+
+func TestWritePasswordFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "passwords")
+	err := os.WriteFile(path, []byte("old"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwords := []vmtools.InitialPassword{{Username: "alice", Password: "s3cret"}, {Username: "zoe", Password: "hunter2"}}
+	err = vmtools.WritePasswordFile(path, passwords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600, got %v", info.Mode().Perm())
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "alice:s3cret\nzoe:hunter2\n"
+	if string(got) != want {
+		t.Error(cmp.Diff(want, string(got)))
+	}
+}
+
+func TestCloudInitPassword(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig()
+	config.Users = []vmtools.User{{Username: "alice", Ip: "10.90.9.9", Password: "$6$salt$hash"}}
+	docs, err := config.CloudInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `#cloud-config
+users:
+  - default
+  - name: alice
+    passwd: $6$salt$hash
+    lock_passwd: false
+`
+	if len(docs) != 1 || docs[0].UserData != want {
+		t.Error(cmp.Diff(want, docs))
+	}
+}
+
+func TestMergeIgnoresPasswords(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig(vmtools.WithInput(bytes.NewBufferString("alice")))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := vmtools.AdditionalUsers{Users: []vmtools.User{{Username: "alice", Ip: "10.90.9.9", Password: "$6$salt$hash"}}}
+	got := config.MergeUsers(existing)
+	want := vmtools.MergeResult{Present: 1}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestMergeReusesExistingPasswords(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig(vmtools.WithInput(bytes.NewBufferString("alice bob")), vmtools.WithRandom(&countingReader{}))
+	err := config.CreateUsers([]string{"10.90.9.9", "10.90.9.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwords, err := config.GeneratePasswords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := vmtools.AdditionalUsers{Users: []vmtools.User{{Username: "alice", Ip: "10.90.9.9", Password: "$6$salt$hash"}}}
+	config.MergeUsers(existing)
+	want := []vmtools.User{
+		{Username: "alice", Ip: "10.90.9.9", Password: "$6$salt$hash"},
+		{Username: "bob", Ip: "10.90.9.9", Password: passwords[1].Hash},
+		{Username: "alice", Ip: "10.90.9.10", Password: "$6$salt$hash"},
+		{Username: "bob", Ip: "10.90.9.10", Password: passwords[1].Hash},
+	}
+	if !cmp.Equal(config.Users, want) {
+		t.Error(cmp.Diff(want, config.Users))
+	}
+}
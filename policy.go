@@ -0,0 +1,161 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// UsernamePolicy decides which usernames are valid.
+type UsernamePolicy struct {
+	Name string
+	// Pattern must match the whole username, including the rule for its
+	// first character.
+	Pattern   *regexp.Regexp
+	MinLength int
+	MaxLength int
+	// Lowercase folds usernames to lower case before they are checked.
+	Lowercase bool
+	// Description says what Pattern allows, for error messages.
+	Description string
+}
+
+var (
+	// PolicyStrict only allows letters. It is the default.
+	PolicyStrict = UsernamePolicy{
+		Name:        "strict",
+		Pattern:     regexp.MustCompile(`^[a-z]+$`),
+		MinLength:   1,
+		MaxLength:   32,
+		Lowercase:   true,
+		Description: "Special characters and numbers are not allowed.",
+	}
+	// PolicyPOSIX allows the POSIX portable filename character set, without
+	// a leading hyphen.
+	PolicyPOSIX = UsernamePolicy{
+		Name:        "posix",
+		Pattern:     regexp.MustCompile(`^[A-Za-z0-9._][A-Za-z0-9._-]*$`),
+		MinLength:   1,
+		MaxLength:   32,
+		Description: "Only letters, digits, '.', '_' and '-' are allowed, and it cannot start with '-'.",
+	}
+	// PolicyDebian is the default NAME_REGEX of Debian's adduser.
+	PolicyDebian = UsernamePolicy{
+		Name:        "debian",
+		Pattern:     regexp.MustCompile(`^[a-z][-a-z0-9_]*\$?$`),
+		MinLength:   1,
+		MaxLength:   32,
+		Lowercase:   true,
+		Description: "It must start with a letter, followed by letters, digits, '_' or '-', and may end with '$'.",
+	}
+	// PolicyAD follows the rules for an Active Directory sAMAccountName.
+	PolicyAD = UsernamePolicy{
+		Name:        "ad",
+		Pattern:     regexp.MustCompile(`^[a-z0-9_](?:[^"/\\\[\]:;|=,+*?<>@\s]*[^."/\\\[\]:;|=,+*?<>@\s])?$`),
+		MinLength:   1,
+		MaxLength:   20,
+		Lowercase:   true,
+		Description: "It must start with a letter, digit or '_' and cannot contain spaces or any of \" / \\ [ ] : ; | = , + * ? < > @, or end with '.'.",
+	}
+)
+
+func getUsernamePolicies() []UsernamePolicy {
+	return []UsernamePolicy{PolicyStrict, PolicyPOSIX, PolicyDebian, PolicyAD}
+}
+
+// UsernamePolicyByName returns the preset called name.
+func UsernamePolicyByName(name string) (UsernamePolicy, error) {
+	var names []string
+	for _, p := range getUsernamePolicies() {
+		if p.Name == name {
+			return p, nil
+		}
+		names = append(names, p.Name)
+	}
+	return UsernamePolicy{}, fmt.Errorf("Unknown username policy '%v', expected one of: %v", name, strings.Join(names, ", "))
+}
+
+// NewUsernamePolicy creates a custom policy from a regular expression. The
+// pattern is anchored to match the whole username.
+func NewUsernamePolicy(pattern string, min, max int, lowercase bool) (UsernamePolicy, error) {
+	r, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return UsernamePolicy{}, fmt.Errorf("Invalid username pattern: %v", err)
+	}
+	if min < 1 || max < min {
+		return UsernamePolicy{}, fmt.Errorf("Invalid username length range %d-%d", min, max)
+	}
+	return UsernamePolicy{
+		Name:        "custom",
+		Pattern:     r,
+		MinLength:   min,
+		MaxLength:   max,
+		Lowercase:   lowercase,
+		Description: fmt.Sprintf("It must match '%v'.", pattern),
+	}, nil
+}
+
+// WithUsernamePolicy sets the policy that usernames are checked against.
+func WithUsernamePolicy(p UsernamePolicy) func(*Config) {
+	return func(c *Config) {
+		c.policy = p
+	}
+}
+
+// UsernameError is returned for a username that breaks a policy.
+type UsernameError struct {
+	Username string
+	Policy   string
+	Rule     string
+}
+
+func (e *UsernameError) Error() string {
+	return fmt.Sprintf("Invalid username '%v' for policy '%v'. %v", e.Username, e.Policy, e.Rule)
+}
+
+// Validate checks username against the policy and returns it as it should
+// be written out.
+func (p UsernamePolicy) Validate(username string) (string, error) {
+	name := username
+	if p.Lowercase {
+		name = strings.ToLower(name)
+	}
+	if n := len(name); n < p.MinLength || n > p.MaxLength {
+		rule := fmt.Sprintf("It must be between %d and %d characters long.", p.MinLength, p.MaxLength)
+		return "", &UsernameError{Username: username, Policy: p.Name, Rule: rule}
+	}
+	if !p.Pattern.MatchString(name) {
+		return "", &UsernameError{Username: username, Policy: p.Name, Rule: p.Description}
+	}
+	return name, nil
+}
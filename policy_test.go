@@ -0,0 +1,117 @@
+package vmtools_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+)
+
+func TestUsernamePolicies(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		policy   vmtools.UsernamePolicy
+		username string
+		want     string
+		valid    bool
+	}{
+		{policy: vmtools.PolicyStrict, username: "Alice", want: "alice", valid: true},
+		{policy: vmtools.PolicyStrict, username: "alice2", valid: false},
+		{policy: vmtools.PolicyStrict, username: "svc_build", valid: false},
+		{policy: vmtools.PolicyPOSIX, username: "j.doe", want: "j.doe", valid: true},
+		{policy: vmtools.PolicyPOSIX, username: "Alice2", want: "Alice2", valid: true},
+		{policy: vmtools.PolicyPOSIX, username: "-alice", valid: false},
+		{policy: vmtools.PolicyPOSIX, username: "al ice", valid: false},
+		{policy: vmtools.PolicyDebian, username: "svc_build", want: "svc_build", valid: true},
+		{policy: vmtools.PolicyDebian, username: "alice2", want: "alice2", valid: true},
+		{policy: vmtools.PolicyDebian, username: "machine$", want: "machine$", valid: true},
+		{policy: vmtools.PolicyDebian, username: "2alice", valid: false},
+		{policy: vmtools.PolicyDebian, username: "j.doe", valid: false},
+		{policy: vmtools.PolicyDebian, username: strings.Repeat("a", 33), valid: false},
+		{policy: vmtools.PolicyAD, username: "J.Doe", want: "j.doe", valid: true},
+		{policy: vmtools.PolicyAD, username: "jdoe.", valid: false},
+		{policy: vmtools.PolicyAD, username: "j@doe", valid: false},
+		{policy: vmtools.PolicyAD, username: strings.Repeat("a", 21), valid: false},
+		{policy: vmtools.PolicyAD, username: ".jdoe", valid: false},
+	}
+	for _, tc := range tcs {
+		name := fmt.Sprintf("%s %s", tc.policy.Name, tc.username)
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.policy.Validate(tc.username)
+			if tc.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !tc.valid {
+				var ue *vmtools.UsernameError
+				if !errors.As(err, &ue) {
+					t.Fatalf("Expected UsernameError, got %v", err)
+				}
+				return
+			}
+			if got != tc.want {
+				t.Errorf("Got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUsernamePolicyByName(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"strict", "posix", "debian", "ad"} {
+		p, err := vmtools.UsernamePolicyByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Name != name {
+			t.Errorf("Got %v, want %v", p.Name, name)
+		}
+	}
+	_, err := vmtools.UsernamePolicyByName("nope")
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestCustomUsernamePolicy(t *testing.T) {
+	t.Parallel()
+	p, err := vmtools.NewUsernamePolicy("svc-[a-z]+", 5, 16, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("svc-build")), vmtools.WithUsernamePolicy(p))
+	err = config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = vmtools.NewConfig(vmtools.WithInput(strings.NewReader("build-svc")), vmtools.WithUsernamePolicy(p))
+	err = config.CreateUsers([]string{"10.90.9.9"})
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestInvalidCustomUsernamePolicy(t *testing.T) {
+	t.Parallel()
+	_, err := vmtools.NewUsernamePolicy("[a-z", 1, 32, true)
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+	_, err = vmtools.NewUsernamePolicy("[a-z]+", 8, 4, true)
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestConfigUsesUsernamePolicy(t *testing.T) {
+	t.Parallel()
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("svc_build alice2")), vmtools.WithUsernamePolicy(vmtools.PolicyDebian))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Users) != 2 {
+		t.Errorf("Expected 2 users, got %v", config.Users)
+	}
+}
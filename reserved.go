@@ -0,0 +1,110 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// getReservedUsernames returns the accounts that Linux distributions and
+// common packages create, which generated entries must never clobber.
+func getReservedUsernames() []string {
+	return []string{
+		"root", "daemon", "bin", "sys", "sync", "games", "man", "lp", "mail",
+		"news", "uucp", "proxy", "www-data", "backup", "list", "irc", "gnats",
+		"nobody", "nfsnobody", "adm", "halt", "shutdown", "operator", "ftp",
+		"wheel", "admin", "sshd", "messagebus", "dbus", "syslog", "_apt",
+		"systemd-network", "systemd-resolve", "systemd-timesync",
+		"systemd-journal", "systemd-coredump", "systemd-oom", "polkitd",
+		"ntp", "chrony", "postfix", "tss", "uuidd", "tcpdump", "rpc",
+		"rpcuser", "avahi", "sssd", "dnsmasq", "lxd", "landscape",
+		"ansible", "vagrant", "ubuntu", "centos", "rocky", "ec2-user",
+		"cloud-user", "docker", "mysql", "postgres", "nginx", "apache",
+		"qemu", "libvirt-qemu",
+	}
+}
+
+// builtinReserved holds getReservedUsernames as a set.
+var builtinReserved = reservedSet(getReservedUsernames())
+
+func reservedSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
+
+// ReservedUsernameError is returned for a username on the denylist.
+type ReservedUsernameError struct {
+	Username string
+}
+
+func (e *ReservedUsernameError) Error() string {
+	return fmt.Sprintf("Username '%v' is reserved for a system account", e.Username)
+}
+
+// WithReservedUsernames adds names to the built in denylist of reserved
+// usernames.
+func WithReservedUsernames(names ...string) func(*Config) {
+	return func(c *Config) {
+		for _, name := range names {
+			c.reserved[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// ReadReservedUsernames reads a denylist with one username per line.
+// Blank lines and lines starting with '#' are skipped.
+func ReadReservedUsernames(r io.Reader) ([]string, error) {
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	return names, scanner.Err()
+}
+
+// reservedNames returns every name on the denylist of c.
+func (c *Config) reservedNames() []string {
+	names := make([]string, 0, len(c.reserved))
+	for name := range c.reserved {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,88 @@
+package vmtools_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCreateUserRejectsReservedNames(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"root", "Daemon", "nobody", "ansible"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := vmtools.CreateUser(name, "10.90.9.9")
+			var re *vmtools.ReservedUsernameError
+			if !errors.As(err, &re) {
+				t.Fatalf("Expected ReservedUsernameError, got %v", err)
+			}
+			if re.Username != strings.ToLower(name) {
+				t.Errorf("Got %v, want %v", re.Username, strings.ToLower(name))
+			}
+		})
+	}
+}
+
+func TestReservedNamesWithOtherPolicies(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("www-data systemd-network")
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithUsernamePolicy(vmtools.PolicyDebian))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	var errs vmtools.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected 2 errors, got %d:\n%v", len(errs), errs)
+	}
+}
+
+func TestReadReservedUsernames(t *testing.T) {
+	t.Parallel()
+	f, err := os.Open("testdata/denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := vmtools.ReadReservedUsernames(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"jenkins", "Gitlab", "deploy"}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestExtendedDenylist(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("bobby gitlab")
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithReservedUsernames("jenkins", "Gitlab"))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	var re *vmtools.ReservedUsernameError
+	if !errors.As(err, &re) {
+		t.Fatalf("Expected ReservedUsernameError, got %v", err)
+	}
+	if re.Username != "gitlab" {
+		t.Errorf("Got %v, want gitlab", re.Username)
+	}
+}
+
+func TestGeneratedNamesAvoidDenylist(t *testing.T) {
+	t.Parallel()
+	g, err := vmtools.NewNameGenerator("first", vmtools.CollisionLetters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("Jenkins Smith")), vmtools.WithReservedUsernames("jenkins"), vmtools.WithUsernamePolicy(vmtools.PolicyDebian))
+	mappings, err := config.CreateUsersFromNames([]string{"10.90.9.9"}, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mappings[0].Username != "jenkins2" {
+		t.Errorf("Got %v, want jenkins2", mappings[0].Username)
+	}
+}
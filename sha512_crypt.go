@@ -0,0 +1,158 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cryptAlphabet is the base64 alphabet used by crypt(3).
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const (
+	sha512CryptDefaultRounds = 5000
+	sha512CryptMinRounds     = 1000
+	sha512CryptMaxRounds     = 999999999
+	sha512CryptMaxSalt       = 16
+)
+
+// SHA512Crypt hashes password with the SHA-512 based crypt(3) scheme,
+// giving a '$6$salt$hash' string. salt may start with 'rounds=N$' to use
+// other than the default 5000 rounds, and only its first 16 characters are
+// used.
+func SHA512Crypt(password, salt string) string {
+	rounds := sha512CryptDefaultRounds
+	customRounds := false
+	if rest, ok := strings.CutPrefix(salt, "rounds="); ok {
+		if n, after, found := strings.Cut(rest, "$"); found {
+			if r, err := strconv.Atoi(n); err == nil {
+				rounds = min(max(r, sha512CryptMinRounds), sha512CryptMaxRounds)
+				customRounds = true
+				salt = after
+			}
+		}
+	}
+	if len(salt) > sha512CryptMaxSalt {
+		salt = salt[:sha512CryptMaxSalt]
+	}
+	key := []byte(password)
+	saltBytes := []byte(salt)
+
+	b := sha512.New()
+	b.Write(key)
+	b.Write(saltBytes)
+	b.Write(key)
+	digestB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(key)
+	a.Write(saltBytes)
+	for i := len(key); i > 0; i -= sha512.Size {
+		a.Write(digestB[:min(i, sha512.Size)])
+	}
+	for i := len(key); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(key)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	dp := sha512.New()
+	for range len(key) {
+		dp.Write(key)
+	}
+	p := repeatDigest(dp.Sum(nil), len(key))
+
+	ds := sha512.New()
+	for range 16 + int(digestA[0]) {
+		ds.Write(saltBytes)
+	}
+	s := repeatDigest(ds.Sum(nil), len(saltBytes))
+
+	c := digestA
+	for i := range rounds {
+		h := sha512.New()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString("$6$")
+	if customRounds {
+		fmt.Fprintf(&out, "rounds=%d$", rounds)
+	}
+	out.WriteString(salt)
+	out.WriteString("$")
+	for i := 0; i < 21; i++ {
+		// Each group of three bytes is taken from across the digest.
+		b2, b1, b0 := c[i*22%63], c[(i*22+21)%63], c[(i*22+42)%63]
+		writeCrypt64(&out, uint(b2)<<16|uint(b1)<<8|uint(b0), 4)
+	}
+	writeCrypt64(&out, uint(c[63]), 2)
+	return out.String()
+}
+
+// repeatDigest repeats digest until it is n bytes long.
+func repeatDigest(digest []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, digest[:min(len(digest), n-len(out))]...)
+	}
+	return out
+}
+
+// writeCrypt64 writes the n low 6-bit groups of w, lowest first.
+func writeCrypt64(out *strings.Builder, w uint, n int) {
+	for range n {
+		out.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
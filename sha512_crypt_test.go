@@ -0,0 +1,48 @@
+package vmtools_test
+
+import (
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+)
+
+func TestSHA512Crypt(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		password string
+		salt     string
+		want     string
+	}{
+		{
+			password: "Hello world!",
+			salt:     "saltstring",
+			want:     "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		},
+		{
+			password: "Hello world!",
+			salt:     "rounds=10000$saltstringsaltstring",
+			want:     "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		},
+		{
+			password: "we have a short salt string but not a short password",
+			salt:     "rounds=77777$short",
+			want:     "$6$rounds=77777$short$WuQyW2YR.hBNpjjRhpYD/ifIw05xdfeEyQoMxIXbkvr0gge1a1x3yRULJ5CCaUeOxFmtlcGZelFl5CxtgfiAc0",
+		},
+		{
+			password: "a very much longer text to encrypt.  This one even stretches over morethan one line.",
+			salt:     "rounds=1400$anotherlongsaltstring",
+			want:     "$6$rounds=1400$anotherlongsalts$POfYwTEok97VWcjxIiSOjiykti.o/pQs.wPvMxQ6Fm7I6IoYN3CmLs66x9t0oSwbtEW7o7UmJEiDwGqd8p4ur1",
+		},
+		{
+			password: "the minimum number is still observed",
+			salt:     "rounds=10$roundstoolow",
+			want:     "$6$rounds=1000$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX.",
+		},
+	}
+	for _, tt := range tests {
+		got := vmtools.SHA512Crypt(tt.password, tt.salt)
+		if got != tt.want {
+			t.Errorf("SHA512Crypt(%q, %q):\nGot:  %v\nWant: %v", tt.password, tt.salt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// MinRSABits is the smallest RSA modulus accepted in an ssh key.
+const MinRSABits = 2048
+
+// SSHKey is a parsed public key from an authorized_keys line.
+type SSHKey struct {
+	Type        string
+	Bits        int
+	Comment     string
+	Fingerprint string
+}
+
+func getWeakKeyTypes() []string {
+	return []string{"ssh-dss"}
+}
+
+func getSupportedKeyTypes() []string {
+	return []string{
+		"ssh-rsa",
+		"ssh-ed25519",
+		"ecdsa-sha2-nistp256",
+		"ecdsa-sha2-nistp384",
+		"ecdsa-sha2-nistp521",
+		"sk-ssh-ed25519@openssh.com",
+		"sk-ecdsa-sha2-nistp256@openssh.com",
+	}
+}
+
+// WithKeyDir makes every user pick up the public keys in
+// <dir>/<username>.pub, in addition to any keys given in the input.
+// Users without a key file get no extra keys.
+func WithKeyDir(dir string) func(*Config) {
+	return func(c *Config) {
+		c.keyDir = dir
+	}
+}
+
+// ParseAuthorizedKey parses a single line in authorized_keys format:
+// optional options, the key type, the base64 encoded key and an optional
+// comment. Weak key types and RSA keys shorter than MinRSABits are
+// rejected.
+func ParseAuthorizedKey(line string) (SSHKey, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return SSHKey{}, errors.New("Empty ssh key")
+	}
+	if !isKeyType(fields[0]) {
+		// The line starts with options, which can contain quoted spaces.
+		rest := skipKeyOptions(strings.TrimSpace(line))
+		fields = strings.Fields(rest)
+	}
+	if len(fields) < 2 {
+		return SSHKey{}, errors.New("Invalid ssh key, expected a key type followed by the key")
+	}
+	keyType := fields[0]
+	if slices.Contains(getWeakKeyTypes(), keyType) {
+		return SSHKey{}, fmt.Errorf("ssh key type '%v' is too weak", keyType)
+	}
+	if !slices.Contains(getSupportedKeyTypes(), keyType) {
+		return SSHKey{}, fmt.Errorf("Unsupported ssh key type '%v'", keyType)
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return SSHKey{}, fmt.Errorf("Invalid ssh key data: %v", err)
+	}
+
+	key := SSHKey{
+		Type:        keyType,
+		Comment:     strings.Join(fields[2:], " "),
+		Fingerprint: "SHA256:" + base64.RawStdEncoding.EncodeToString(sha256Sum(blob)),
+	}
+	key.Bits, err = keyBits(keyType, blob)
+	if err != nil {
+		return SSHKey{}, err
+	}
+	if keyType == "ssh-rsa" && key.Bits < MinRSABits {
+		return SSHKey{}, fmt.Errorf("RSA key is %d bits, at least %d are required", key.Bits, MinRSABits)
+	}
+	return key, nil
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+func isKeyType(s string) bool {
+	return slices.Contains(getSupportedKeyTypes(), s) || slices.Contains(getWeakKeyTypes(), s)
+}
+
+// skipKeyOptions returns line without its leading options field.
+func skipKeyOptions(line string) string {
+	quoted, escaped := false, false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case (r == ' ' || r == '\t') && !quoted:
+			return line[i:]
+		}
+	}
+	return ""
+}
+
+// keyBits checks that the key blob holds a key of the given type and
+// returns its size.
+func keyBits(keyType string, blob []byte) (int, error) {
+	fields, err := readSSHStrings(blob)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) == 0 || string(fields[0]) != keyType {
+		return 0, fmt.Errorf("ssh key data does not match key type '%v'", keyType)
+	}
+	switch keyType {
+	case "ssh-rsa":
+		if len(fields) != 3 {
+			return 0, errors.New("Invalid RSA key data")
+		}
+		return new(big.Int).SetBytes(fields[2]).BitLen(), nil
+	case "ssh-ed25519", "sk-ssh-ed25519@openssh.com":
+		if len(fields) < 2 || len(fields[1]) != 32 {
+			return 0, errors.New("Invalid ed25519 key data")
+		}
+		return 256, nil
+	default:
+		if len(fields) < 3 {
+			return 0, errors.New("Invalid ECDSA key data")
+		}
+		switch string(fields[1]) {
+		case "nistp256":
+			return 256, nil
+		case "nistp384":
+			return 384, nil
+		case "nistp521":
+			return 521, nil
+		}
+		return 0, fmt.Errorf("Unsupported ECDSA curve '%s'", fields[1])
+	}
+}
+
+// readSSHStrings splits an ssh wire format blob into its length prefixed
+// fields.
+func readSSHStrings(blob []byte) ([][]byte, error) {
+	var fields [][]byte
+	for len(blob) > 0 {
+		if len(blob) < 4 {
+			return nil, errors.New("Truncated ssh key data")
+		}
+		n := binary.BigEndian.Uint32(blob)
+		blob = blob[4:]
+		if uint64(n) > uint64(len(blob)) {
+			return nil, errors.New("Truncated ssh key data")
+		}
+		fields = append(fields, blob[:n])
+		blob = blob[n:]
+	}
+	return fields, nil
+}
+
+// ReadAuthorizedKeys reads every key in an authorized_keys style input,
+// skipping blank lines and comments.
+func ReadAuthorizedKeys(r io.Reader) ([]string, error) {
+	var keys []string
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		_, err := ParseAuthorizedKey(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		keys = append(keys, text)
+	}
+	return keys, scanner.Err()
+}
+
+// dirKeys returns the keys in the key directory for username, reading each
+// file only once.
+func (c *Config) dirKeys(username string) ([]string, error) {
+	if c.keyDir == "" {
+		return nil, nil
+	}
+	if keys, ok := c.keyCache[username]; ok {
+		return keys, nil
+	}
+	name := filepath.Join(c.keyDir, username+".pub")
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		c.keyCache[username] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys, err := ReadAuthorizedKeys(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	c.keyCache[username] = keys
+	return keys, nil
+}
+
+// KeyReport writes the type, size, fingerprint and comment of every ssh key
+// given to each user, so reviewers can check who is getting access.
+func (c *Config) KeyReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tVM_IP\tTYPE\tBITS\tFINGERPRINT\tCOMMENT")
+	for _, u := range c.Users {
+		for _, line := range u.SSHKeys {
+			key, err := ParseAuthorizedKey(line)
+			if err != nil {
+				return fmt.Errorf("User '%v': %v", u.Username, err)
+			}
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%d\t%v\t%v\n", u.Username, u.Ip, key.Type, key.Bits, key.Fingerprint, key.Comment)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,124 @@
+package vmtools_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+const ed25519Key = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPj9ek6l6nzdLW221eRVo2dzS0bM/mMWELW9KZbT0IMA alice@laptop"
+
+func TestParseAuthorizedKey(t *testing.T) {
+	t.Parallel()
+	got, err := vmtools.ParseAuthorizedKey(ed25519Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := vmtools.SSHKey{
+		Type:        "ssh-ed25519",
+		Bits:        256,
+		Comment:     "alice@laptop",
+		Fingerprint: "SHA256:uLr0B4uWhWY5imHeYC4u0P/qAv+AxbQjPKghY0S51V4",
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestParseAuthorizedKeyWithOptions(t *testing.T) {
+	t.Parallel()
+	for _, options := range []string{
+		`from="10.0.0.0/8",command="echo hello world"`,
+		`command="echo \"a b\""`,
+	} {
+		got, err := vmtools.ParseAuthorizedKey(options + " " + ed25519Key)
+		if err != nil {
+			t.Fatalf("%v: %v", options, err)
+		}
+		if got.Type != "ssh-ed25519" || got.Comment != "alice@laptop" {
+			t.Errorf("%v: got %v", options, got)
+		}
+	}
+}
+
+func TestParseAuthorizedKeyErrors(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name, key string
+	}{
+		{name: "rsa 1024", key: "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQDEmpGzsQFuJDGu67Oozttuep7f5uMTsdID7jsHBFrCRGnQwEnqFgsulglAF8M3RaklpYe1xeOUXrmLb8lkdbRKejBBMOCZeUnto0X1LDd1TwZoPQoVAxBQN9OVzdgK54iiw2llg6UBiYP0kOjLFr2UjYpolmU+Hpo+7EkcNt3/BQ== weak@old"},
+		{name: "dsa", key: "ssh-dss AAAAB3NzaC1kc3MAAACBALipvpMhrM4LQaSJK2LukU71T3RKuOYlBiARRDgiXrim15E8TqC1S1Vvrw5W03UR9QTy03DpHTNpBEEMMkiLoOikvouG5UEo1r4I2/UjxHJrpShbDj6JO1ZHFTFcYdtb6yw9tL5+KUZSwfPK8HB8sTHj/LNV/hEVXSkDhPX/DU2lAAAAFQDjpcpdH8yuscfPu5yGHKHkxWbKpwAAAIBf+vD7skGKWouHpYws6phxAPWXAQFrePMMTU/ADKTa9w+KSyWTAVjYWVZwV2FP8nv1CCHUnXSG76VF06Aeo7ov8wjKONo5myuU/w9s9uFeW836xU6BEww+p736hKDmgAs+fBy6YA9oZBR/S96wfNOqQBhfWN/plgW6NFkVapUXIwAAAIAecILSbjQZM1E5ylC/xRobEHjv4bKfVo6m+E8vBEUhfTKya9ZtOAFibLhCUmxaviHXrLgYjJLhxV5vRE7BMEsbvlcyAVXATrascD3REDJxfZp3ADOlQMNEQ/kGcGijOLOhZAqYlcaRTR4QJ5k97d1jtQDkJUmUy9DV4wQS63J6TA== root@vm"},
+		{name: "bad base64", key: "ssh-ed25519 not-base64!"},
+		{name: "type mismatch", key: "ssh-rsa" + strings.TrimPrefix(ed25519Key, "ssh-ed25519")},
+		{name: "unknown type", key: "ssh-foo AAAA"},
+		{name: "missing key", key: "ssh-ed25519"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := vmtools.ParseAuthorizedKey(tc.key)
+			if err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestKeysFromKeyDir(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("alice bobby zoe")
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithKeyDir("testdata/keys"))
+	err := config.CreateUsers([]string{"10.90.9.9", "192.168.1.4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for _, u := range config.Users {
+		got[u.Username+" "+u.Ip] = len(u.SSHKeys)
+	}
+	want := map[string]int{
+		"alice 10.90.9.9":   1,
+		"bobby 10.90.9.9":   2,
+		"zoe 10.90.9.9":     0,
+		"alice 192.168.1.4": 1,
+		"bobby 192.168.1.4": 2,
+		"zoe 192.168.1.4":   0,
+	}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}
+
+func TestInlineKeyRejected(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("username,ip,ssh_authorized_keys\nbobby,10.90.9.9,ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQDEmpGzsQFuJDGu67Oozttuep7f5uMTsdID7jsHBFrCRGnQwEnqFgsulglAF8M3RaklpYe1xeOUXrmLb8lkdbRKejBBMOCZeUnto0X1LDd1TwZoPQoVAxBQN9OVzdgK54iiw2llg6UBiYP0kOjLFr2UjYpolmU+Hpo+7EkcNt3/BQ== weak@old\n")
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsersFromCSV()
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestKeyReport(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("username,ip,ssh_authorized_keys\nalice,10.90.9.9," + ed25519Key + "\nzoe,10.90.9.9,\n")
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsersFromCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = config.KeyReport(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `USERNAME  VM_IP      TYPE         BITS  FINGERPRINT                                         COMMENT
+alice     10.90.9.9  ssh-ed25519  256   SHA256:uLr0B4uWhWY5imHeYC4u0P/qAv+AxbQjPKghY0S51V4  alice@laptop
+`
+	got := b.String()
+	if got != want {
+		t.Errorf("Got:\n%v\nWant:\n%v", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StreamUsers does what CreateUsers, GenerateYaml and WriteYaml do
+// together, writing each entry to c.Output as it is created instead of
+// keeping every entry in memory. The output is the same, byte for byte.
+// Every username and ip address is checked before anything is written, so
+// invalid input gives no output. c.Users is left unchanged. Only FormatYAML
+// can be streamed.
+func (c *Config) StreamUsers(ips []string) error {
+	if c.format != FormatYAML {
+		return errors.New("Only yaml output can be streamed")
+	}
+	if err := c.checkOrder(); err != nil {
+		return err
+	}
+	words, err := readWords(c.Input)
+	if err != nil {
+		return err
+	}
+	usernames, ips, err := c.prepareUsers(words, ips)
+	if err != nil {
+		return err
+	}
+	if len(usernames) == 0 || len(ips) == 0 {
+		return errors.New("No users detected, empty output")
+	}
+
+	// Entries only differ in their ip address, so create each user once on
+	// the first ip address to find any errors up front.
+	users := make([]User, len(usernames))
+	var errs ValidationErrors
+	for i, w := range usernames {
+		users[i], err = c.newUser(w.name, ips[0], w.attrs)
+		if err != nil {
+			errs = append(errs, newValidationError(w.inputPos, w.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addr, _ := ParseIP(ip)
+		addrs[i] = addr.String()
+	}
+
+	w := bufio.NewWriter(c.Output)
+	err = c.writeHeader(w, c.newHeaderContext(len(users)*len(addrs), len(users), addrs))
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteString("additional_users:\n")
+	if err != nil {
+		return err
+	}
+	// Entries come out in the order orderUsers would give the buffered
+	// path: sorting by username alone puts each user's entries together,
+	// everything else goes host by host.
+	switch c.order {
+	case OrderUsername:
+		slices.SortStableFunc(users, func(a, b User) int {
+			return strings.Compare(a.Username, b.Username)
+		})
+	case OrderIP:
+		slices.SortStableFunc(addrs, compareIPs)
+	}
+	var b bytes.Buffer
+	if c.order == OrderUsername && c.group != GroupHost {
+		for _, u := range users {
+			for _, ip := range addrs {
+				u.Ip = ip
+				err = c.writeEntry(w, &b, u, "")
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return w.Flush()
+	}
+	for _, ip := range addrs {
+		for i, u := range users {
+			u.Ip = ip
+			comment := ""
+			if c.group == GroupHost && i == 0 {
+				comment = "# " + ip
+			}
+			err = c.writeEntry(w, &b, u, comment)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// writeEntry writes one entry of the additional_users list as GenerateYaml
+// would, using b as scratch space. Grouped output goes through a node like
+// it does in GenerateYaml, with comment before the entry.
+func (c *Config) writeEntry(w *bufio.Writer, b *bytes.Buffer, u User, comment string) error {
+	b.Reset()
+	encoder := yaml.NewEncoder(b)
+	encoder.SetIndent(c.indent)
+	var err error
+	if c.group == GroupHost {
+		var node yaml.Node
+		err = node.Encode(AdditionalUsers{Users: []User{u}})
+		if err == nil {
+			mappingValue(&node, "additional_users").Content[0].HeadComment = comment
+			err = encoder.Encode(&node)
+		}
+	} else {
+		err = encoder.Encode(AdditionalUsers{Users: []User{u}})
+	}
+	if err != nil {
+		return err
+	}
+	encoder.Close()
+	_, entry, _ := bytes.Cut(b.Bytes(), []byte("\n"))
+	_, err = w.Write(entry)
+	return err
+}
@@ -0,0 +1,112 @@
+package vmtools_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStreamUsersMatchesBuffered(t *testing.T) {
+	t.Parallel()
+	input := "bobby zoe\nalice bobby\n"
+	ips := []string{"10.90.9.9", "::ffff:192.168.1.4", "2001:db8::1"}
+	newConfig := func(out *bytes.Buffer) *vmtools.Config {
+		return vmtools.NewConfig(
+			vmtools.WithInput(strings.NewReader(input)),
+			vmtools.WithOutput(out),
+			vmtools.SetIndent(4),
+			vmtools.WithHeader("---\n# {{.Users}} users on {{.Hosts}} hosts"),
+			vmtools.WithClock(func() time.Time { return time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC) }),
+			vmtools.WithDefaults(vmtools.UserAttributes{Groups: []string{"docker"}, Shell: "/bin/bash", Sudo: boolPtr(true)}),
+		)
+	}
+
+	var want bytes.Buffer
+	buffered := newConfig(&want)
+	err := buffered.CreateUsers(ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = buffered.GenerateYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = buffered.WriteYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	streamed := newConfig(&got)
+	err = streamed.StreamUsers(ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.String() != got.String() {
+		t.Error(cmp.Diff(want.String(), got.String()))
+	}
+	if !cmp.Equal(streamed.Duplicates, buffered.Duplicates, cmp.Comparer(func(a, b vmtools.Duplicate) bool { return a.String() == b.String() })) {
+		t.Errorf("Expected the same duplicates, got %v and %v", streamed.Duplicates, buffered.Duplicates)
+	}
+}
+
+func TestStreamUsersMatchesBufferedOrder(t *testing.T) {
+	t.Parallel()
+	input := "zoe bobby alice"
+	ips := []string{"10.0.0.10", "2001:db8::1", "10.0.0.9"}
+	for _, order := range []string{vmtools.OrderInput, vmtools.OrderUsername, vmtools.OrderIP} {
+		for _, group := range []string{vmtools.GroupNone, vmtools.GroupHost} {
+			var want, got bytes.Buffer
+			buffered := vmtools.NewConfig(vmtools.WithInput(strings.NewReader(input)), vmtools.WithOutput(&want), vmtools.WithOrder(order), vmtools.WithGrouping(group))
+			err := buffered.CreateUsers(ips)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = buffered.GenerateYaml()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = buffered.WriteYaml()
+			if err != nil {
+				t.Fatal(err)
+			}
+			streamed := vmtools.NewConfig(vmtools.WithInput(strings.NewReader(input)), vmtools.WithOutput(&got), vmtools.WithOrder(order), vmtools.WithGrouping(group))
+			err = streamed.StreamUsers(ips)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want.String() != got.String() {
+				t.Errorf("order %v, group %v: %v", order, group, cmp.Diff(want.String(), got.String()))
+			}
+		}
+	}
+}
+
+func TestStreamUsersWritesNothingOnError(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("bobby bobby2 root")), vmtools.WithOutput(&out))
+	err := config.StreamUsers([]string{"10.90.9.9"})
+	var errs vmtools.ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Errorf("Expected 2 validation errors, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no output, got:\n%v", out.String())
+	}
+}
+
+func TestStreamUsersRejectsOtherFormats(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	config := vmtools.NewConfig(vmtools.WithInput(strings.NewReader("bobby")), vmtools.WithOutput(&out), vmtools.WithFormat(vmtools.FormatJSON))
+	err := config.StreamUsers([]string{"10.90.9.9"})
+	if err == nil {
+		t.Error("Expected an error for json output")
+	}
+}
@@ -0,0 +1,122 @@
+/*BSD 3-Clause License
+
+Copyright (c) 2024, Jeffrey Smith
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package vmtools
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidationError is an invalid entry in the input, with where it was
+// found.
+type ValidationError struct {
+	// Source describes where the entry is, such as "line 3, word 2",
+	// "row 4" or "ip 2".
+	Source string
+	// Line is the input line or row, or 0 for ip addresses.
+	Line int
+	// Word is the position of the word on its line, or the position of
+	// an ip address in the list of ip addresses. It is 0 if unknown.
+	Word  int
+	Value string
+	// Rule is the rule that the value broke.
+	Rule string
+	Err  error
+}
+
+// inputPos is where a value was found in the input.
+type inputPos struct {
+	kind       string
+	line, word int
+}
+
+func linePos(line, word int) inputPos {
+	return inputPos{kind: "line", line: line, word: word}
+}
+
+func rowPos(row int) inputPos {
+	return inputPos{kind: "row", line: row}
+}
+
+// ipPos is the position of an ip address in the list of ip addresses.
+func ipPos(n int) inputPos {
+	return inputPos{kind: "ip", word: n}
+}
+
+func (p inputPos) source() string {
+	switch {
+	case p.kind == "ip":
+		return fmt.Sprintf("ip %d", p.word)
+	case p.kind == "row":
+		return fmt.Sprintf("row %d", p.line)
+	case p.word == 0:
+		return fmt.Sprintf("line %d", p.line)
+	}
+	return fmt.Sprintf("line %d, word %d", p.line, p.word)
+}
+
+func newValidationError(pos inputPos, value string, err error) *ValidationError {
+	rule := err.Error()
+	var ue *UsernameError
+	if errors.As(err, &ue) {
+		rule = ue.Rule
+	}
+	return &ValidationError{Source: pos.source(), Line: pos.line, Word: pos.word, Value: value, Rule: rule, Err: err}
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Source, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors holds every invalid entry found in an input, so they
+// can all be fixed at once.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
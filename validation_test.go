@@ -0,0 +1,83 @@
+package vmtools_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/JeffreySmith/vmtools"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestCreateUsersCollectsAllErrors(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("bobby zoe2\nalice\n\njohn_doe millybrown")
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsers([]string{"10.90.9.9", "10.90.9.999"})
+
+	var got vmtools.ValidationErrors
+	if !errors.As(err, &got) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	rule := vmtools.PolicyStrict.Description
+	want := vmtools.ValidationErrors{
+		{Source: "line 1, word 2", Line: 1, Word: 2, Value: "zoe2", Rule: rule},
+		{Source: "line 4, word 1", Line: 4, Word: 1, Value: "john_doe", Rule: rule},
+		{Source: "ip 2", Line: 0, Word: 2, Value: "10.90.9.999", Rule: "Invalid ip address '10.90.9.999'"},
+	}
+	if !cmp.Equal(got, want, cmpopts.IgnoreFields(vmtools.ValidationError{}, "Err")) {
+		t.Error(cmp.Diff(got, want, cmpopts.IgnoreFields(vmtools.ValidationError{}, "Err")))
+	}
+	if config.Users != nil {
+		t.Errorf("Expected no users, got %v", config.Users)
+	}
+}
+
+func TestValidationErrorsUnwrap(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("zoe2")
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsers([]string{"10.90.9.9"})
+	var ue *vmtools.UsernameError
+	if !errors.As(err, &ue) {
+		t.Fatalf("Expected UsernameError, got %v", err)
+	}
+	if ue.Username != "zoe2" {
+		t.Errorf("Got %v, want zoe2", ue.Username)
+	}
+}
+
+func TestAttributeErrorsReportedOncePerUser(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("bobby zoe")
+	defaults := vmtools.UserAttributes{Shell: "/bin/nope"}
+	config := vmtools.NewConfig(vmtools.WithInput(input), vmtools.WithDefaults(defaults))
+	err := config.CreateUsers([]string{"10.90.9.9", "192.168.1.4"})
+	var errs vmtools.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected 2 errors, got %d:\n%v", len(errs), errs)
+	}
+}
+
+func TestCSVCollectsAllErrors(t *testing.T) {
+	t.Parallel()
+	input := strings.NewReader("bobby2,10.90.9.9\nzoe,10.90.9.9\nalice,10.0.0.1,\nmilly,bad\n")
+	config := vmtools.NewConfig(vmtools.WithInput(input))
+	err := config.CreateUsersFromCSV()
+	var errs vmtools.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	var got []int
+	for _, e := range errs {
+		got = append(got, e.Line)
+	}
+	want := []int{1, 4}
+	if !cmp.Equal(got, want) {
+		t.Error(cmp.Diff(got, want))
+	}
+}